@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// openapiDocument describes the REST API.
+//
+//go:embed openapi.yaml
+var openapiDocument []byte
+
+// apiDevice is a device as served by the REST API.
+type apiDevice struct {
+	UniqueId string `json:"unique_id"`
+	Name     string `json:"name"`
+	// Ports is null until the AC answered the first poll.
+	Ports map[string]apiPort `json:"ports"`
+}
+
+// apiPort is the state of an indoor unit with the modes and fan speeds as
+// their text identifiers, e.g. "cool" and "medium_low".
+type apiPort struct {
+	Power              bool    `json:"power"`
+	Mode               string  `json:"mode"`
+	TargetTemperature  float64 `json:"target_temperature"`
+	Fan                string  `json:"fan"`
+	VerticalSwing      bool    `json:"vertical_swing"`
+	HorizontalSwing    bool    `json:"horizontal_swing"`
+	Econo              bool    `json:"econo"`
+	Powerchill         bool    `json:"powerchill"`
+	Streamer           bool    `json:"streamer"`
+	RoomTemperature    float64 `json:"room_temperature"`
+	OutdoorTemperature float64 `json:"outdoor_temperature"`
+}
+
+// apiPatch holds the fields to change on a port. Mode and Fan accept the text
+// identifiers or the numbers sent by the AC, only the known ones.
+type apiPatch struct {
+	// Port is the indoor unit to change, port1 when empty.
+	Port              string       `json:"port"`
+	Power             *bool        `json:"power"`
+	Mode              *daikin.Mode `json:"mode"`
+	TargetTemperature *float64     `json:"target_temperature"`
+	Fan               *daikin.Fan  `json:"fan"`
+	VerticalSwing     *bool        `json:"vertical_swing"`
+	Econo             *bool        `json:"econo"`
+	Powerchill        *bool        `json:"powerchill"`
+}
+
+func newAPIDevice(d *device, state *daikin.State) apiDevice {
+	a := apiDevice{UniqueId: d.config.UniqueId, Name: d.config.Name}
+	if state == nil {
+		return a
+	}
+	a.Ports = make(map[string]apiPort)
+	for _, name := range state.PortNames() {
+		p, _ := state.Port(name)
+		a.Ports[name] = apiPort{
+			Power:              p.Power != 0,
+			Mode:               p.Mode.String(),
+			TargetTemperature:  p.Temperature,
+			Fan:                p.Fan.String(),
+			VerticalSwing:      p.VSwing != 0,
+			HorizontalSwing:    p.HSwing != 0,
+			Econo:              p.Econo != 0,
+			Powerchill:         p.Powerchill != 0,
+			Streamer:           p.Streamer != 0,
+			RoomTemperature:    p.Sensors.RoomTemp,
+			OutdoorTemperature: p.Sensors.OutTemp,
+		}
+	}
+	return a
+}
+
+// desiredState maps the patch to the state sent to the AC, rejecting the values
+// the AC does not support.
+func (p apiPatch) desiredState() (daikin.DesiredState, error) {
+	if p.Mode != nil {
+		if err := p.Mode.Validate(); err != nil {
+			return daikin.DesiredState{}, err
+		}
+	}
+	if p.Fan != nil {
+		if err := p.Fan.Validate(); err != nil {
+			return daikin.DesiredState{}, err
+		}
+	}
+	if p.TargetTemperature != nil {
+		if err := daikin.ValidateTemperature(*p.TargetTemperature); err != nil {
+			return daikin.DesiredState{}, err
+		}
+	}
+	port := daikin.PortState{
+		Power:       boolInt(p.Power),
+		Mode:        p.Mode,
+		Temperature: p.TargetTemperature,
+		Fan:         p.Fan,
+		VSwing:      boolInt(p.VerticalSwing),
+		Econo:       boolInt(p.Econo),
+		Powerchill:  boolInt(p.Powerchill),
+	}
+	if port == (daikin.PortState{}) {
+		return daikin.DesiredState{}, errors.New("nothing to change")
+	}
+	name := p.Port
+	if name == "" {
+		name = daikin.DefaultPortName
+	}
+	return daikin.NewDesiredState(name, port)
+}
+
+func boolInt(b *bool) *int {
+	if b == nil {
+		return nil
+	}
+	v := 0
+	if *b {
+		v = 1
+	}
+	return &v
+}
+
+// apiHandler returns the REST API routes, requiring token as a bearer token
+// when it is not empty.
+func (s *server) apiHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/openapi.yaml", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openapiDocument)
+	})
+	mux.Handle("GET /api/devices", bearerAuth(token, http.HandlerFunc(s.listDevices)))
+	mux.Handle("GET /api/devices/{id}", bearerAuth(token, http.HandlerFunc(s.getDevice)))
+	mux.Handle("PATCH /api/devices/{id}", bearerAuth(token, http.HandlerFunc(s.patchDevice)))
+	return mux
+}
+
+func (s *server) listDevices(w http.ResponseWriter, _ *http.Request) {
+	s.devicesMu.RLock()
+	devices := make([]apiDevice, 0, len(s.devices))
+	for _, key := range slices.Sorted(maps.Keys(s.devices)) {
+		d := s.devices[key]
+		devices = append(devices, newAPIDevice(d, d.climate.State()))
+	}
+	s.devicesMu.RUnlock()
+	writeJSON(w, http.StatusOK, map[string]any{"devices": devices})
+}
+
+func (s *server) getDevice(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.lookupDevice(r.PathValue("id"))
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("device %q not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIDevice(d, d.climate.State()))
+}
+
+func (s *server) patchDevice(w http.ResponseWriter, r *http.Request) {
+	d, ok := s.lookupDevice(r.PathValue("id"))
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Sprintf("device %q not found", r.PathValue("id")))
+		return
+	}
+
+	var patch apiPatch
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("invalid body: %s", err))
+		return
+	}
+	desired, err := patch.desiredState()
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	current := d.climate.State()
+	if current != nil && patch.Port != "" {
+		if _, ok := current.Port(patch.Port); !ok {
+			apiError(w, http.StatusBadRequest, fmt.Sprintf("the ac has no %s", patch.Port))
+			return
+		}
+	}
+
+	state, err := d.climate.SetState(r.Context(), desired)
+	if err != nil {
+		slog.Error("failed to send command to ac", slog.String("device", d.config.UniqueId), slog.String("source", "api"), slog.Any("error", err))
+		status := http.StatusBadGateway
+		if daikin.IsTimeout(err) {
+			status = http.StatusGatewayTimeout
+		}
+		apiError(w, status, err.Error())
+		return
+	}
+	if state == nil {
+		state = d.climate.State()
+	}
+	writeJSON(w, http.StatusOK, newAPIDevice(d, state))
+}
+
+// lookupDevice finds a running device by unique_id or name, ignoring case.
+func (s *server) lookupDevice(id string) (*device, bool) {
+	s.devicesMu.RLock()
+	defer s.devicesMu.RUnlock()
+	if d, ok := s.devices[strings.ToLower(id)]; ok {
+		return d, true
+	}
+	for _, d := range s.devices {
+		if strings.EqualFold(d.config.Name, id) {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// bearerAuth rejects the requests without token in the Authorization header.
+// Without a token every request is let through.
+func bearerAuth(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="daikin"`)
+			apiError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func apiError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+)
+
+func TestPatchDeviceRejectsInvalidValues(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "unknown mode number", body: `{"mode":99}`, want: "unknown mode 99"},
+		{name: "unknown mode name", body: `{"mode":"fan"}`, want: `unknown value "fan"`},
+		{name: "unknown fan as text", body: `{"fan":"1"}`, want: `unknown value "1"`},
+		{name: "unknown fan number", body: `{"fan":1}`, want: "unknown fan 1"},
+		{name: "temperature too low", body: `{"target_temperature":5}`, want: "out of range"},
+		{name: "temperature too high", body: `{"target_temperature":40}`, want: "out of range"},
+		{name: "unknown field", body: `{"temperature":23}`, want: "unknown field"},
+		{name: "nothing to change", body: `{}`, want: "nothing to change"},
+	}
+
+	// the body is rejected before the climate is used
+	s := &server{devices: map[string]*device{
+		"sala": {config: config.Devices{UniqueId: "sala", Name: "Sala"}},
+	}}
+	handler := s.apiHandler("")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPatch, "/api/devices/sala", strings.NewReader(tt.body)))
+
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusBadRequest, rec.Body)
+			}
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(resp.Error, tt.want) {
+				t.Errorf("error = %q, want it to contain %q", resp.Error, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIPatchDesiredState(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "names", body: `{"mode":"fan_only","fan":"auto","target_temperature":23}`, want: `"mode":6,"temperature":23,"fan":17`},
+		{name: "known numbers", body: `{"mode":3,"fan":"7"}`, want: `"mode":3,"fan":7`},
+		{name: "temperature bounds", body: `{"target_temperature":10}`, want: `"temperature":10`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch apiPatch
+			if err := json.Unmarshal([]byte(tt.body), &patch); err != nil {
+				t.Fatal(err)
+			}
+			desired, err := patch.desiredState()
+			if err != nil {
+				t.Fatalf("desiredState() error = %v", err)
+			}
+			data, err := json.Marshal(desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("desired state = %s, want it to contain %s", data, tt.want)
+			}
+		})
+	}
+}
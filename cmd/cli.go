@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+)
+
+const usage = `usage: app [command] [flags]
+
+commands:
+  serve                       run the MQTT bridge (default)
+  state <device>              print the decoded state of an AC
+  set <device> key=value...   change an AC, e.g. mode=cool temp=23 fan=auto swing=on
+  status <device>             print the connectivity status of an AC
+  validate                    check the config file
+  decode [capture]            decode a captured body, or encode JSON with --encode
+  proxy <device>              forward to an AC logging the decrypted traffic
+  discover                    scan the network for ACs and print a devices block
+  healthcheck                 query /readyz of the running bridge, for container health checks
+
+<device> is the unique_id or name of a configured device. It can be omitted
+when --address and --key are given.
+
+Run "app <command> -h" for the flags of each command.
+`
+
+// command is a CLI subcommand receiving its arguments without the command name.
+type command func(ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"serve":       serveCommand,
+	"state":       stateCommand,
+	"set":         setCommand,
+	"status":      statusCommand,
+	"validate":    validateCommand,
+	"decode":      decodeCommand,
+	"proxy":       proxyCommand,
+	"discover":    discoverCommand,
+	"healthcheck": healthcheckCommand,
+}
+
+// Run dispatches args, without the program name, to the matching subcommand.
+// Without a command, or when the first argument is a flag, the bridge is served
+// so existing deployments keep working.
+func Run(ctx context.Context, args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serveCommand(ctx, args)
+	}
+	if args[0] == "help" {
+		fmt.Fprint(os.Stdout, usage)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	err := cmd(ctx, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	return err
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configFlag := fs.String("config", "", "path to the config file (default $DAIKIN_CONFIG or ./config.yaml)")
+	return fs, configFlag
+}
+
+// parseArgs parses flags placed anywhere among the positional arguments, which
+// are returned in order.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func serveCommand(ctx context.Context, args []string) error {
+	fs, configFlag := newFlagSet("serve")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	return Server(ctx, config.Path(*configFlag))
+}
+
+func validateCommand(ctx context.Context, args []string) error {
+	fs, configFlag := newFlagSet("validate")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	return Validate(ctx, config.Path(*configFlag))
+}
+
+// output is the format used by the commands printing data.
+type output string
+
+const (
+	outputTable output = "table"
+	outputJSON  output = "json"
+)
+
+func (o *output) String() string { return string(*o) }
+
+func (o *output) Set(value string) error {
+	switch output(value) {
+	case outputTable, outputJSON:
+		*o = output(value)
+		return nil
+	default:
+		return fmt.Errorf("must be %s or %s", outputTable, outputJSON)
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// decodeCommand decodes a captured body, or encodes JSON into one with --encode.
+func decodeCommand(ctx context.Context, args []string) error {
+	fs, _ := newFlagSet("decode")
+	var (
+		key      = fs.String("key", "", "secret key of the AC (required)")
+		request  = fs.Bool("request", false, "the capture is a request body, without the header byte that follows the IV in responses")
+		encode   = fs.Bool("encode", false, "encode the given JSON instead of decoding a capture")
+		trailing = fs.String("trailing", "", "bytes appended to the JSON when encoding (default BZ with --request, none for responses)")
+		header   = fs.Int("header", -1, "header byte written after the IV when encoding a response, copy it from a captured response as its meaning is unknown")
+		out      = outputTable
+	)
+	fs.Var(&out, "output", "output format: table or json")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *key == "" {
+		return errors.New("--key is required")
+	}
+	secretKey, err := base64.StdEncoding.DecodeString(*key)
+	if err != nil {
+		return fmt.Errorf("invalid secret key: %w", err)
+	}
+	input, err := readInput(args)
+	if err != nil {
+		return err
+	}
+
+	if *encode {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, input); err != nil {
+			return fmt.Errorf("invalid json: %w", err)
+		}
+		iv := make([]byte, 16)
+		if _, err := rand.Read(iv); err != nil {
+			return fmt.Errorf("generating IV: %w", err)
+		}
+		// only requests end with BZ
+		suffix := *trailing
+		if !flagSet(fs, "trailing") && *request {
+			suffix = "BZ"
+		}
+		var headerByte *byte
+		if !*request {
+			if *header < 0 || *header > 255 {
+				return errors.New("--header is required to encode a response, between 0 and 255")
+			}
+			b := byte(*header)
+			headerByte = &b
+		}
+		frame, err := daikin.EncodeFrame(secretKey, iv, headerByte, append(compact.Bytes(), suffix...))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stdout, base64.StdEncoding.EncodeToString(frame))
+		return nil
+	}
+
+	data, err := decodeCapture(string(input))
+	if err != nil {
+		return err
+	}
+	frame, err := daikin.DecodeFrame(secretKey, data, !*request)
+	if err != nil {
+		return err
+	}
+	if out == outputJSON {
+		return printJSON(frame)
+	}
+
+	crc := fmt.Sprintf("%04x ok", frame.CRC)
+	if !frame.ValidCRC() {
+		crc = fmt.Sprintf("%04x mismatch, expected %04x", frame.CRC, frame.ExpectedCRC)
+	}
+	headerText := "none"
+	if frame.Header != nil {
+		headerText = fmt.Sprintf("%d (0x%02x)", *frame.Header, *frame.Header)
+	}
+	payload := "not valid json, check the secret key and --request"
+	if frame.JSON != nil {
+		var indented bytes.Buffer
+		_ = json.Indent(&indented, frame.JSON, "", "  ")
+		payload = indented.String()
+	}
+	return printTable([][2]string{
+		{"iv", hex.EncodeToString(frame.IV)},
+		{"header", headerText},
+		{"plaintext length", strconv.Itoa(len(frame.Plaintext))},
+		{"crc16", crc},
+		{"trailing", fmt.Sprintf("%q (%s)", frame.Trailing, hex.EncodeToString(frame.Trailing))},
+		{"json", payload},
+	})
+}
+
+// flagSet reports whether the flag was given on the command line.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	var set bool
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// readInput returns the first argument, the content of the file it names when
+// prefixed with @, or stdin when it is - or missing.
+func readInput(args []string) ([]byte, error) {
+	if len(args) == 0 || args[0] == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	if path, ok := strings.CutPrefix(args[0], "@"); ok {
+		return os.ReadFile(path)
+	}
+	return []byte(args[0]), nil
+}
+
+// decodeCapture accepts a body captured as hex or as the base64 sent on the wire.
+func decodeCapture(capture string) ([]byte, error) {
+	capture = strings.Join(strings.Fields(capture), "")
+	if data, err := hex.DecodeString(capture); err == nil {
+		return data, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(capture)
+	if err != nil {
+		return nil, errors.New("capture is neither hex nor base64")
+	}
+	return data, nil
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+const testSecretKey = "MDEyMzQ1Njc4OWFiY2RlZg=="
+
+// captureStdout returns what fn writes to stdout.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	err = fn()
+	w.Close()
+	out, readErr := io.ReadAll(r)
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return string(out), err
+}
+
+func TestDecodeCommandEncode(t *testing.T) {
+	key, _ := base64.StdEncoding.DecodeString(testSecretKey)
+	tests := []struct {
+		name         string
+		args         []string
+		wantHeader   *byte
+		wantTrailing string
+	}{
+		{name: "request ends with BZ", args: []string{"--request"}, wantTrailing: "BZ"},
+		{name: "request with another trailer", args: []string{"--request", "--trailing", "XY"}, wantTrailing: "XY"},
+		{name: "request without trailer", args: []string{"--request", "--trailing", ""}},
+		{name: "response has the given header and no trailer", args: []string{"--header", "12"}, wantHeader: ptr(byte(12))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"--key", testSecretKey, "--encode"}, tt.args...)
+			args = append(args, `{ "port1": {"power": 1} }`)
+			out, err := captureStdout(t, func() error { return decodeCommand(context.Background(), args) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+			if err != nil {
+				t.Fatalf("output %q is not base64: %v", out, err)
+			}
+			frame, err := daikin.DecodeFrame(key, data, tt.wantHeader != nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !frame.ValidCRC() {
+				t.Error("invalid crc")
+			}
+			if string(frame.JSON) != `{"port1":{"power":1}}` {
+				t.Errorf("JSON = %s", frame.JSON)
+			}
+			if string(frame.Trailing) != tt.wantTrailing {
+				t.Errorf("Trailing = %q, want %q", frame.Trailing, tt.wantTrailing)
+			}
+			if tt.wantHeader != nil && (frame.Header == nil || *frame.Header != *tt.wantHeader) {
+				t.Errorf("Header = %v, want %d", frame.Header, *tt.wantHeader)
+			}
+		})
+	}
+}
+
+func TestDecodeCommandEncodeResponseNeedsHeader(t *testing.T) {
+	err := decodeCommand(context.Background(), []string{"--key", testSecretKey, "--encode", `{"power":1}`})
+	if err == nil || !strings.Contains(err.Error(), "--header") {
+		t.Fatalf("error = %v, want --header to be required", err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
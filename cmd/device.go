@@ -0,0 +1,300 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+	"github.com/billbatista/ha-daikin-smart-ac-br/ha"
+	"github.com/billbatista/ha-daikin-smart-ac-br/locale"
+)
+
+// setKeys maps the keys accepted by the set command to the climate commands.
+var setKeys = map[string]string{
+	"mode":               ha.CommandMode,
+	"fan":                ha.CommandFanMode,
+	"fan_mode":           ha.CommandFanMode,
+	"swing":              ha.CommandSwingMode,
+	"swing_mode":         ha.CommandSwingMode,
+	"temp":               ha.CommandTemperature,
+	"temperature":        ha.CommandTemperature,
+	"target_temperature": ha.CommandTemperature,
+}
+
+// deviceFlags are shared by the commands talking to a single AC.
+type deviceFlags struct {
+	config  *string
+	address *string
+	key     *string
+	locale  *string
+	output  output
+	// configLocale is the locale of the config file, when it was loaded.
+	configLocale string
+}
+
+func newDeviceFlagSet(name string) (*flag.FlagSet, *deviceFlags) {
+	fs, configFlag := newFlagSet(name)
+	f := &deviceFlags{
+		config:  configFlag,
+		address: fs.String("address", "", "address of the AC, e.g. http://192.168.0.15:15914, instead of a configured device"),
+		key:     fs.String("key", "", "secret key of the AC, used with --address"),
+		locale:  fs.String("locale", os.Getenv(locale.Env), "language of the output: pt-BR, en or es (default the config locale, or $"+locale.Env+")"),
+		output:  outputTable,
+	}
+	fs.Var(&f.output, "output", "output format: table or json")
+	return fs, f
+}
+
+// client returns the client for the AC given by --address and --key, or for the
+// configured device named by the first positional argument, which is then
+// removed from args.
+func (f *deviceFlags) client(ctx context.Context, args []string) (*daikin.Client, []string, error) {
+	address, secretKey, args, err := f.device(ctx, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := newDaikinClient(address, secretKey)
+	return client, args, err
+}
+
+// device returns the address and secret key selected like in client.
+func (f *deviceFlags) device(ctx context.Context, args []string) (string, string, []string, error) {
+	if *f.address != "" || *f.key != "" {
+		if *f.address == "" || *f.key == "" {
+			return "", "", nil, errors.New("--address and --key must be given together")
+		}
+		return *f.address, *f.key, args, nil
+	}
+
+	if len(args) == 0 {
+		return "", "", nil, errors.New("missing device, give its unique_id or name, or --address and --key")
+	}
+	cfg, err := config.Load(ctx, config.Path(*f.config))
+	if err != nil {
+		return "", "", nil, err
+	}
+	d, err := findDevice(cfg, args[0])
+	if err != nil {
+		return "", "", nil, err
+	}
+	f.configLocale = cfg.Locale
+	address := d.Address
+	if state, err := config.LoadState(config.StatePath(cfg, config.Path(*f.config))); err == nil {
+		// the address the bridge found the AC at after it changed
+		address = state.Address(d)
+	}
+	if address == "" {
+		address, err = lookupAddress(d)
+		if err != nil {
+			return "", "", nil, err
+		}
+	}
+	return address, d.SecretKey, args[1:], nil
+}
+
+// lookupAddress returns the address of a device configured without one that the
+// bridge did not find yet, from the ARP entry of its MAC.
+func lookupAddress(d config.Devices) (string, error) {
+	if mac, err := net.ParseMAC(d.Mac); err == nil {
+		if addr, ok := daikin.LookupMAC(mac); ok {
+			return (&url.URL{Scheme: "http", Host: netip.AddrPortFrom(addr, daikin.DefaultPort).String()}).String(), nil
+		}
+	}
+	return "", fmt.Errorf("the address of device %q is not known yet, run the bridge so it finds the AC, set its address or give --address", d.UniqueId)
+}
+
+// outputLocale returns the locale selected with --locale, or the one of the
+// config file.
+func (f *deviceFlags) outputLocale() (locale.Locale, error) {
+	if *f.locale != "" {
+		return locale.Parse(*f.locale)
+	}
+	return locale.Parse(f.configLocale)
+}
+
+// findDevice looks up a device by unique_id or name, ignoring case.
+func findDevice(cfg *config.Config, name string) (config.Devices, error) {
+	for _, d := range cfg.Devices {
+		if strings.EqualFold(d.UniqueId, name) || strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+	}
+	return config.Devices{}, fmt.Errorf("device %q not found in config", name)
+}
+
+// newDaikinClient creates a client for the AC at address using the base64
+// encoded secret key. An empty address is a device the bridge has to find on
+// the network first.
+func newDaikinClient(address string, secretKey string) (*daikin.Client, error) {
+	target := &url.URL{Scheme: "http"}
+	if address != "" {
+		var err error
+		target, err = url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address %q: %w", address, err)
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(secretKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key: %w", err)
+	}
+	return daikin.NewClient(target, key), nil
+}
+
+func stateCommand(ctx context.Context, args []string) error {
+	fs, flags := newDeviceFlagSet("state")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	client, _, err := flags.client(ctx, args)
+	if err != nil {
+		return err
+	}
+	state, err := client.State(ctx)
+	if err != nil {
+		return err
+	}
+	return printState(flags, state)
+}
+
+func setCommand(ctx context.Context, args []string) error {
+	fs, flags := newDeviceFlagSet("set")
+	port := fs.String("port", daikin.DefaultPortName, "indoor unit to change on multi split ACs, e.g. port2")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	client, args, err := flags.client(ctx, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("nothing to set, give key=value pairs such as mode=cool temp=23 fan=auto swing=on")
+	}
+
+	var portState daikin.PortState
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		command, known := setKeys[strings.ToLower(key)]
+		if !ok || !known {
+			return fmt.Errorf("invalid argument %q, expected one of mode, fan, swing or temp as key=value", arg)
+		}
+		if err := ha.ApplyCommand(&portState, command, value); err != nil {
+			return err
+		}
+	}
+	desired, err := daikin.NewDesiredState(*port, portState)
+	if err != nil {
+		return err
+	}
+
+	state, err := client.SetState(ctx, desired)
+	if err != nil {
+		return err
+	}
+	return printState(flags, state)
+}
+
+func statusCommand(ctx context.Context, args []string) error {
+	fs, flags := newDeviceFlagSet("status")
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	client, _, err := flags.client(ctx, args)
+	if err != nil {
+		return err
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if flags.output == outputJSON {
+		return printJSON(status)
+	}
+	loc, err := flags.outputLocale()
+	if err != nil {
+		return err
+	}
+	return printTable([][2]string{
+		{loc.Text("cli.username"), status.Username},
+		{loc.Text("cli.station_ssid"), status.StationSSID},
+		{loc.Text("cli.ac"), strconv.Itoa(status.Status.AC)},
+		{loc.Text("cli.station"), strconv.Itoa(status.Status.STA)},
+		{loc.Text("cli.cloud"), strconv.Itoa(status.Status.Cloud)},
+		{loc.Text("cli.auth"), strconv.Itoa(status.Status.Auth)},
+	})
+}
+
+func printState(flags *deviceFlags, state *daikin.State) error {
+	if flags.output == outputJSON {
+		return printJSON(state)
+	}
+	loc, err := flags.outputLocale()
+	if err != nil {
+		return err
+	}
+	var rows [][2]string
+	ports := state.PortNames()
+	for _, port := range ports {
+		// the rows are prefixed with the port only on multi split ACs
+		prefix := ""
+		if len(ports) > 1 {
+			prefix = port + " "
+		}
+		p, _ := state.Port(port)
+		portRows := [][2]string{
+			{loc.Text("cli.power"), strconv.Itoa(p.Power)},
+			{loc.Text("cli.mode"), loc.Mode(p.Mode)},
+			{loc.Text("cli.target_temperature"), strconv.FormatFloat(p.Temperature, 'f', -1, 64)},
+			{loc.Text("cli.fan"), loc.Fan(p.Fan)},
+			{loc.Text("cli.room_temperature"), strconv.FormatFloat(p.Sensors.RoomTemp, 'f', -1, 64)},
+			{loc.Text("cli.outdoor_temperature"), strconv.FormatFloat(p.Sensors.OutTemp, 'f', -1, 64)},
+			{loc.Text("cli.horizontal_swing"), strconv.Itoa(p.HSwing)},
+			{loc.Text("cli.vertical_swing"), strconv.Itoa(p.VSwing)},
+			{loc.Text("cli.econo"), strconv.Itoa(p.Econo)},
+			{loc.Text("cli.powerchill"), strconv.Itoa(p.Powerchill)},
+			{loc.Text("cli.streamer"), strconv.Itoa(p.Streamer)},
+			{loc.Text("cli.firmware"), p.FWVer},
+		}
+		for _, name := range slices.Sorted(maps.Keys(p.Extra)) {
+			portRows = append(portRows, [2]string{loc.Text("cli.unknown") + " " + name, string(p.Extra[name])})
+		}
+		for _, row := range portRows {
+			rows = append(rows, [2]string{prefix + row[0], row[1]})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(state.Extra)) {
+		rows = append(rows, [2]string{loc.Text("cli.unknown") + " " + name, string(state.Extra[name])})
+	}
+	return printTable(rows)
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func printTable(rows [][2]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\n", row[0], row[1])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+)
+
+func TestDeviceFlagsAddress(t *testing.T) {
+	const configYAML = `
+mqtt:
+  host: localhost
+  port: "1883"
+devices:
+  - unique_id: sala
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+`
+	tests := []struct {
+		name    string
+		state   *config.State
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "not found yet",
+			wantErr: `the address of device "sala" is not known yet`,
+		},
+		{
+			name: "found by the bridge",
+			state: &config.State{Devices: map[string]config.DeviceState{
+				"sala": {Address: "http://192.168.0.20:15914"},
+			}},
+			want: "http://192.168.0.20:15914",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.yaml")
+			if err := os.WriteFile(path, []byte(configYAML), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if tt.state != nil {
+				if err := tt.state.Save(filepath.Join(dir, config.StateFileName)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			fs, flags := newDeviceFlagSet("test")
+			if err := fs.Parse([]string{"--config", path}); err != nil {
+				t.Fatal(err)
+			}
+
+			address, _, _, err := flags.device(context.Background(), []string{"sala"})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("device() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if address != tt.want {
+				t.Fatalf("device() address = %q, want %q", address, tt.want)
+			}
+		})
+	}
+}
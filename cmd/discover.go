@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+	"gopkg.in/yaml.v3"
+)
+
+// discoveredDevice is the config entry printed for a discovered AC.
+type discoveredDevice struct {
+	Name          string `yaml:"name"`
+	UniqueId      string `yaml:"unique_id"`
+	Address       string `yaml:"address"`
+	SecretKey     string `yaml:"secret_key,omitempty"`
+	SecretKeyFile string `yaml:"secret_key_file,omitempty"`
+}
+
+// discoverCommand scans the local network for ACs, matches them to the
+// configured devices and to the keys given with --key, and prints a devices
+// block ready to be pasted in the config file.
+func discoverCommand(ctx context.Context, args []string) error {
+	fs, configFlag := newFlagSet("discover")
+	var (
+		subnets subnetsFlag
+		keys    stringsFlag
+		port    = fs.Int("port", daikin.DefaultPort, "port the ACs listen on")
+		timeout = fs.Duration("timeout", time.Second, "how long to wait for each host")
+	)
+	fs.Var(&subnets, "subnet", "subnet to scan, e.g. 192.168.0.0/24, can be repeated (default the local /24 subnets)")
+	fs.Var(&keys, "key", "secret key to try on the hosts found, can be repeated")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	devices, err := configuredDevices(ctx, *configFlag)
+	if err != nil {
+		return err
+	}
+	opts := daikin.DiscoverOptions{
+		Subnets: subnets,
+		Port:    *port,
+		Keys:    make(map[string][]byte),
+		Timeout: *timeout,
+	}
+	for _, d := range devices {
+		key, err := base64.StdEncoding.DecodeString(d.SecretKey)
+		if err != nil {
+			return fmt.Errorf("invalid secret key of %q: %w", d.UniqueId, err)
+		}
+		opts.Keys[d.UniqueId] = key
+	}
+	extra := make(map[string]string)
+	for i, k := range keys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil {
+			return fmt.Errorf("invalid --key %q: %w", k, err)
+		}
+		name := "key" + strconv.Itoa(i+1)
+		opts.Keys[name], extra[name] = key, k
+	}
+
+	if len(opts.Subnets) == 0 {
+		if opts.Subnets, err = daikin.LocalSubnets(); err != nil {
+			return err
+		}
+	}
+	for _, subnet := range opts.Subnets {
+		fmt.Fprintf(os.Stderr, "scanning %s\n", subnet)
+	}
+	hosts, err := daikin.Discover(ctx, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "found %d ACs\n", len(hosts))
+	if len(hosts) == 0 {
+		return nil
+	}
+
+	var (
+		matched   []discoveredDevice
+		unmatched []string
+	)
+	for _, host := range hosts {
+		address := host.Address.String()
+		if d, ok := findByUniqueId(devices, host.Key); ok {
+			entry := discoveredDevice{Name: d.Name, UniqueId: d.UniqueId, Address: address, SecretKeyFile: d.SecretKeyFile}
+			if d.SecretKeyFile == "" {
+				entry.SecretKey = d.SecretKey
+			}
+			matched = append(matched, entry)
+			continue
+		}
+		if key, ok := extra[host.Key]; ok {
+			id := "daikin_" + strings.NewReplacer(".", "_", ":", "_").Replace(host.Address.Hostname())
+			matched = append(matched, discoveredDevice{Name: id, UniqueId: id, Address: address, SecretKey: key})
+			continue
+		}
+		unmatched = append(unmatched, address)
+	}
+
+	if len(matched) > 0 {
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(map[string][]discoveredDevice{"devices": matched}); err != nil {
+			return err
+		}
+		encoder.Close()
+	} else {
+		fmt.Fprintln(os.Stdout, "devices:")
+	}
+	for _, address := range unmatched {
+		fmt.Fprintf(os.Stdout, "  # %s did not decrypt with any known key, add its secret_key:\n", address)
+		fmt.Fprintf(os.Stdout, "  # - name: \n  #   unique_id: \n  #   address: %s\n  #   secret_key: \n", address)
+	}
+	for _, d := range devices {
+		if !slices.ContainsFunc(matched, func(m discoveredDevice) bool { return m.UniqueId == d.UniqueId }) {
+			fmt.Fprintf(os.Stderr, "configured device %q was not found\n", d.UniqueId)
+		}
+	}
+	return nil
+}
+
+// configuredDevices returns the devices of the config file, or none when the
+// default config file does not exist yet.
+func configuredDevices(ctx context.Context, configFlag string) ([]config.Devices, error) {
+	cfg, err := config.Load(ctx, config.Path(configFlag))
+	if errors.Is(err, fs.ErrNotExist) && configFlag == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Devices, nil
+}
+
+// findByUniqueId returns the device matched by the key name Discover reported.
+func findByUniqueId(devices []config.Devices, uniqueId string) (config.Devices, bool) {
+	for _, d := range devices {
+		if uniqueId != "" && d.UniqueId == uniqueId {
+			return d, true
+		}
+	}
+	return config.Devices{}, false
+}
+
+// subnetsFlag collects the repeated --subnet flags.
+type subnetsFlag []netip.Prefix
+
+func (s *subnetsFlag) String() string { return fmt.Sprint(*s) }
+
+func (s *subnetsFlag) Set(value string) error {
+	subnet, err := netip.ParsePrefix(value)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, subnet)
+	return nil
+}
+
+// stringsFlag collects a repeated string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
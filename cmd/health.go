@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+)
+
+// deviceHealth tracks when each AC last answered a poll, for /devices/health.
+type deviceHealth struct {
+	mu      sync.Mutex
+	devices map[string]*healthEntry
+}
+
+type healthEntry struct {
+	UniqueId string     `json:"unique_id"`
+	Name     string     `json:"name"`
+	LastPoll *time.Time `json:"last_poll,omitempty"`
+	// Age is how many seconds ago the last successful poll was, null when the
+	// AC never answered.
+	Age *float64 `json:"age_seconds"`
+	// Healthy is false when the AC never answered or, with ?max_age, answered
+	// longer than max_age ago.
+	Healthy bool `json:"healthy"`
+}
+
+func newDeviceHealth() *deviceHealth {
+	return &deviceHealth{devices: make(map[string]*healthEntry)}
+}
+
+// track starts reporting the device, keeping its last poll when it was only
+// restarted.
+func (h *deviceHealth) track(key string, d config.Devices) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.devices[key]; ok {
+		e.UniqueId, e.Name = d.UniqueId, d.Name
+		return
+	}
+	h.devices[key] = &healthEntry{UniqueId: d.UniqueId, Name: d.Name}
+}
+
+// forget stops reporting a device that is no longer configured.
+func (h *deviceHealth) forget(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.devices, key)
+}
+
+// polled records a successful poll of the device.
+func (h *deviceHealth) polled(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if e, ok := h.devices[key]; ok {
+		now := time.Now()
+		e.LastPoll = &now
+	}
+}
+
+// ServeHTTP lists the devices with the age of their last successful poll. With
+// ?max_age=<duration> it answers 503 when any device is older, so it can be
+// used as a probe.
+func (h *deviceHealth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var maxAge time.Duration
+	if value := r.URL.Query().Get("max_age"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid max_age: %s", err), http.StatusBadRequest)
+			return
+		}
+		maxAge = d
+	}
+
+	h.mu.Lock()
+	entries := make([]healthEntry, 0, len(h.devices))
+	for _, key := range slices.Sorted(maps.Keys(h.devices)) {
+		e := *h.devices[key]
+		if e.LastPoll != nil {
+			age := time.Since(*e.LastPoll)
+			seconds := age.Seconds()
+			e.Age = &seconds
+			e.Healthy = maxAge == 0 || age <= maxAge
+		}
+		entries = append(entries, e)
+	}
+	h.mu.Unlock()
+
+	status := http.StatusOK
+	if maxAge > 0 && slices.ContainsFunc(entries, func(e healthEntry) bool { return !e.Healthy }) {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, map[string]any{"devices": entries})
+}
+
+// serveHealthz answers as long as the process is serving requests.
+func (s *server) serveHealthz(w http.ResponseWriter, _ *http.Request) {
+	io.WriteString(w, "ok\n")
+}
+
+// serveReadyz answers 503 until the config is loaded and the devices started,
+// and while the MQTT connection is down.
+func (s *server) serveReadyz(w http.ResponseWriter, _ *http.Request) {
+	if !s.ready.Load() {
+		http.Error(w, "starting", http.StatusServiceUnavailable)
+		return
+	}
+	if bridge := s.connected.Load(); bridge == nil || !bridge.Connected() {
+		http.Error(w, "mqtt not connected", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// healthcheckCommand queries an endpoint of the running bridge and fails unless
+// it answers 200, for the HEALTHCHECK of the image.
+func healthcheckCommand(ctx context.Context, args []string) error {
+	fs, configFlag := newFlagSet("healthcheck")
+	address := fs.String("address", "", "address of the bridge http server (default http.listen of the config, or "+config.DefaultHttpListen+")")
+	path := fs.String("path", "/readyz", "endpoint to check: /healthz, /readyz or /devices/health")
+	timeout := fs.Duration("timeout", 5*time.Second, "how long to wait for the answer")
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	listen := *address
+	if listen == "" {
+		// only the http section is read, so a config edited into an invalid
+		// one, which the running bridge ignores, still gives its address
+		listen = config.DefaultHttpListen
+		if address, err := config.HttpAddress(config.Path(*configFlag)); err == nil {
+			listen = address
+		}
+	}
+	if listen == "" {
+		return errors.New("the http server is disabled by http.disabled, give --address")
+	}
+	host, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", listen, err)
+	}
+	if host == "" || net.ParseIP(host).IsUnspecified() {
+		host = "127.0.0.1"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+	endpoint := "http://" + net.JoinHostPort(host, port) + *path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("checking %q: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %d: %s", endpoint, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	os.Stdout.Write(body)
+	return nil
+}
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// startHTTP serves the metrics, health and API endpoints unless http.disabled
+// is set.
+func (s *server) startHTTP() {
+	listen := s.config.Http.Address()
+	if listen == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metrics.registry)
+	mux.HandleFunc("GET /healthz", s.serveHealthz)
+	mux.HandleFunc("GET /readyz", s.serveReadyz)
+	mux.Handle("GET /devices/health", s.health)
+	if s.config.Http.Api {
+		mux.Handle("/api/", s.apiHandler(s.config.Http.Token))
+	}
+
+	srv := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	s.http = srv
+	go func() {
+		slog.Info("serving http", slog.String("listen", listen))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("http server failed", slog.String("listen", listen), slog.Any("error", err))
+		}
+	}()
+}
+
+// stopHTTP shuts the HTTP server down, waiting for the requests in flight.
+func (s *server) stopHTTP() {
+	if s.http == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.http.Shutdown(ctx); err != nil {
+		slog.Error("failed to stop http server", slog.Any("error", err))
+	}
+	s.http = nil
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+	"github.com/billbatista/ha-daikin-smart-ac-br/metrics"
+)
+
+// deviceMetrics are the metrics exposed on /metrics for every AC.
+type deviceMetrics struct {
+	registry    *metrics.Registry
+	roomTemp    *metrics.Gauge
+	outdoorTemp *metrics.Gauge
+	targetTemp  *metrics.Gauge
+	power       *metrics.Gauge
+	mode        *metrics.Gauge
+	fan         *metrics.Gauge
+	polls       *metrics.Counter
+	commands    *metrics.Counter
+	errors      *metrics.Counter
+	requests    *metrics.Histogram
+}
+
+// newDeviceMetrics registers the device metrics and the MQTT connection status,
+// read from connected on every scrape.
+func newDeviceMetrics(connected func() bool) *deviceMetrics {
+	r := metrics.NewRegistry()
+	r.GaugeFunc("daikin_mqtt_connected", "Whether the bridge is connected to the MQTT broker.", func() float64 {
+		if connected() {
+			return 1
+		}
+		return 0
+	})
+	return &deviceMetrics{
+		registry:    r,
+		roomTemp:    r.Gauge("daikin_room_temperature_celsius", "Room temperature measured by the indoor unit."),
+		outdoorTemp: r.Gauge("daikin_outdoor_temperature_celsius", "Outdoor temperature measured by the outdoor unit."),
+		targetTemp:  r.Gauge("daikin_target_temperature_celsius", "Target temperature."),
+		power:       r.Gauge("daikin_power", "Whether the indoor unit is on."),
+		mode:        r.Gauge("daikin_mode", "Operation mode code: 0 auto, 2 dry, 3 cool, 4 heat, 6 fan."),
+		fan:         r.Gauge("daikin_fan", "Fan speed code: 3 low to 7 high, 17 auto, 18 quiet."),
+		polls:       r.Counter("daikin_polls_total", "State polls by result."),
+		commands:    r.Counter("daikin_commands_total", "Commands sent by result."),
+		errors:      r.Counter("daikin_errors_total", "Failed requests by error type."),
+		requests:    r.Histogram("daikin_request_duration_seconds", "Latency of the requests made to the ACs.", metrics.DefaultBuckets),
+	}
+}
+
+// requestHook measures the requests made to the AC of device.
+func (m *deviceMetrics) requestHook(device string) daikin.RequestHook {
+	return func(_ string, path string, duration time.Duration, _ error) {
+		m.requests.Observe(duration.Seconds(), "device", device, "endpoint", path)
+	}
+}
+
+// poll records the outcome of a state poll. A poll cancelled by Stop or the
+// shutdown says nothing about the AC and is not recorded.
+func (m *deviceMetrics) poll(device string, state *daikin.State, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil {
+		m.polls.Inc("device", device, "result", "error")
+		m.errors.Inc("device", device, "type", errorType(err))
+		return
+	}
+	m.polls.Inc("device", device, "result", "ok")
+	m.state(device, state)
+}
+
+// command records the outcome of a command, unless it was cancelled like in poll.
+func (m *deviceMetrics) command(device string, state *daikin.State, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+	if err != nil {
+		m.commands.Inc("device", device, "result", "error")
+		m.errors.Inc("device", device, "type", errorType(err))
+		return
+	}
+	m.commands.Inc("device", device, "result", "ok")
+	m.state(device, state)
+}
+
+func (m *deviceMetrics) state(device string, state *daikin.State) {
+	if state == nil {
+		return
+	}
+	for _, name := range state.PortNames() {
+		p, _ := state.Port(name)
+		labels := []string{"device", device, "port", name}
+		m.roomTemp.Set(p.Sensors.RoomTemp, labels...)
+		m.outdoorTemp.Set(p.Sensors.OutTemp, labels...)
+		m.targetTemp.Set(p.Temperature, labels...)
+		m.power.Set(float64(p.Power), labels...)
+		m.mode.Set(float64(p.Mode), labels...)
+		m.fan.Set(float64(p.Fan), labels...)
+	}
+}
+
+// forget removes the series of a device that is no longer configured.
+func (m *deviceMetrics) forget(device string) {
+	m.registry.Delete("device", device)
+}
+
+// errorType classifies err for daikin_errors_total.
+func errorType(err error) string {
+	if daikin.IsTimeout(err) {
+		return "timeout"
+	}
+	switch d := daikin.Diagnose(err); d {
+	case daikin.DiagnosisInvalidResponse:
+		return "crc"
+	case daikin.DiagnosisWrongKey:
+		return "key"
+	default:
+		return string(d)
+	}
+}
+
+// meteredClient records the polls and commands of the AC in the metrics, and
+// the successful polls in the device health.
+type meteredClient struct {
+	*resolvingClient
+	metrics *deviceMetrics
+	health  *deviceHealth
+	device  string
+}
+
+func (c *meteredClient) State(ctx context.Context) (*daikin.State, error) {
+	state, err := c.resolvingClient.State(ctx)
+	c.metrics.poll(c.device, state, err)
+	if err == nil {
+		c.health.polled(c.device)
+	}
+	return state, err
+}
+
+func (c *meteredClient) SetState(ctx context.Context, desired daikin.DesiredState) (*daikin.State, error) {
+	state, err := c.resolvingClient.SetState(ctx, desired)
+	c.metrics.command(c.device, state, err)
+	return state, err
+}
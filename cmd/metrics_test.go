@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+func TestDeviceMetricsPoll(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want []string
+		// absent are series that must not be written
+		absent []string
+	}{
+		{
+			name: "ok",
+			want: []string{`daikin_polls_total{device="sala",result="ok"} 1`},
+		},
+		{
+			name: "unreachable",
+			err:  fmt.Errorf("%w: connection refused", daikin.ErrUnreachable),
+			want: []string{
+				`daikin_polls_total{device="sala",result="error"} 1`,
+				`daikin_errors_total{device="sala",type="unreachable"} 1`,
+			},
+		},
+		{
+			name: "timeout",
+			err:  fmt.Errorf("%w: %w", daikin.ErrUnreachable, context.DeadlineExceeded),
+			want: []string{`daikin_errors_total{device="sala",type="timeout"} 1`},
+		},
+		{
+			name:   "cancelled",
+			err:    fmt.Errorf("making request: %w", context.Canceled),
+			absent: []string{"daikin_polls_total{", "daikin_errors_total{"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newDeviceMetrics(func() bool { return true })
+			var state *daikin.State
+			if tt.err == nil {
+				state = &daikin.State{}
+			}
+			m.poll("sala", state, tt.err)
+
+			var out strings.Builder
+			if _, err := m.registry.WriteTo(&out); err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(out.String(), line+"\n") {
+					t.Errorf("missing %q in\n%s", line, out.String())
+				}
+			}
+			for _, series := range tt.absent {
+				if strings.Contains(out.String(), series) {
+					t.Errorf("unexpected %q in\n%s", series, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestDeviceMetricsCommandCancelled(t *testing.T) {
+	m := newDeviceMetrics(func() bool { return true })
+	m.command("sala", nil, context.Canceled)
+
+	var out strings.Builder
+	if _, err := m.registry.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "daikin_commands_total{") || strings.Contains(out.String(), "daikin_errors_total{") {
+		t.Fatalf("cancelled command recorded:\n%s", out.String())
+	}
+}
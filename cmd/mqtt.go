@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// mqttOptions builds the paho client options for the configured broker.
+func mqttOptions(cfg config.Mqtt) (*pahomqtt.ClientOptions, error) {
+	switch cfg.Scheme {
+	case "", "tcp", "ssl", "ws", "wss":
+	default:
+		return nil, fmt.Errorf("unsupported mqtt scheme %q", cfg.Scheme)
+	}
+
+	if cfg.StateQoS > 2 || cfg.CommandQoS > 2 {
+		return nil, fmt.Errorf("mqtt qos must be 0, 1 or 2")
+	}
+
+	opts := pahomqtt.NewClientOptions().
+		AddBroker(cfg.BrokerURL()).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password)
+	if cfg.ClientId != "" {
+		opts.SetClientID(cfg.ClientId)
+	}
+	if cfg.CleanSession != nil {
+		opts.SetCleanSession(*cfg.CleanSession)
+	}
+
+	if cfg.UsesTLS() {
+		tlsConfig, err := mqttTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+
+	return opts, nil
+}
+
+// mqttTLSConfig loads the CA bundle and client certificate from disk.
+func mqttTLSConfig(cfg config.Mqtt) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("reading mqtt ca_cert: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in mqtt ca_cert %q", cfg.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.ClientCert != "" || cfg.ClientKey != "" {
+		if cfg.ClientCert == "" || cfg.ClientKey == "" {
+			return nil, fmt.Errorf("mqtt client_cert and client_key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading mqtt client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,336 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// testPKI is a CA with a server certificate for broker.local and a client
+// certificate, written as PEM files.
+type testPKI struct {
+	pool       *x509.CertPool
+	server     tls.Certificate
+	caPath     string
+	certPath   string
+	keyPath    string
+	serverName string
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+
+	caKey := newKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, template *x509.Certificate) ([]byte, *ecdsa.PrivateKey) {
+		key := newKey(t)
+		template.SerialNumber = big.NewInt(serial)
+		template.NotBefore = time.Now().Add(-time.Hour)
+		template.NotAfter = time.Now().Add(time.Hour)
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der, key
+	}
+	// the server certificate has no IP address, so dialing 127.0.0.1 needs
+	// server_name
+	serverDER, serverKey := issue(2, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "broker.local"},
+		DNSNames:    []string{"broker.local"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	clientDER, clientKey := issue(3, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "bridge"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	p := &testPKI{
+		pool:       x509.NewCertPool(),
+		server:     tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+		caPath:     filepath.Join(dir, "ca.pem"),
+		certPath:   filepath.Join(dir, "client.pem"),
+		keyPath:    filepath.Join(dir, "client-key.pem"),
+		serverName: "broker.local",
+	}
+	p.pool.AddCert(ca)
+	writePEM(t, p.caPath, "CERTIFICATE", caDER)
+	writePEM(t, p.certPath, "CERTIFICATE", clientDER)
+	keyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, p.keyPath, "EC PRIVATE KEY", keyDER)
+	return p
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tlsBroker is a stand-in for a broker listening with TLS. It reports the
+// result of every server side handshake and answers the MQTT CONNECT with a
+// successful CONNACK.
+type tlsBroker struct {
+	host       string
+	port       string
+	handshakes chan error
+}
+
+func startTLSBroker(t *testing.T, pki *testPKI, requireClientCert bool) *tlsBroker {
+	t.Helper()
+	cfg := &tls.Config{Certificates: []tls.Certificate{pki.server}}
+	if requireClientCert {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = pki.pool
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	b := &tlsBroker{host: host, port: port, handshakes: make(chan error, 8)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn.(*tls.Conn))
+		}
+	}()
+	return b
+}
+
+func (b *tlsBroker) serve(conn *tls.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	err := conn.Handshake()
+	b.handshakes <- err
+	if err != nil {
+		return
+	}
+	buf := make([]byte, 1024)
+	if _, err := conn.Read(buf); err != nil {
+		return
+	}
+	conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+	io.Copy(io.Discard, conn)
+}
+
+// dial connects to the broker with cfg, returning the client or server
+// handshake error.
+func (b *tlsBroker) dial(cfg *tls.Config) error {
+	conn, err := tls.Dial("tcp", net.JoinHostPort(b.host, b.port), cfg)
+	if err == nil {
+		err = conn.Handshake()
+		defer conn.Close()
+	}
+	select {
+	case serverErr := <-b.handshakes:
+		if err == nil {
+			err = serverErr
+		}
+	case <-time.After(5 * time.Second):
+		if err == nil {
+			err = io.ErrNoProgress
+		}
+	}
+	return err
+}
+
+func TestMqttTLSConfigHandshake(t *testing.T) {
+	pki := newTestPKI(t)
+
+	tests := []struct {
+		name              string
+		mqtt              config.Mqtt
+		requireClientCert bool
+		wantErr           bool
+	}{
+		{
+			name: "ca and server name",
+			mqtt: config.Mqtt{CACert: pki.caPath, ServerName: pki.serverName},
+		},
+		{
+			name:    "ca without server name",
+			mqtt:    config.Mqtt{CACert: pki.caPath},
+			wantErr: true,
+		},
+		{
+			name:    "system roots",
+			mqtt:    config.Mqtt{ServerName: pki.serverName},
+			wantErr: true,
+		},
+		{
+			name: "insecure skip verify",
+			mqtt: config.Mqtt{InsecureSkipVerify: true},
+		},
+		{
+			name:              "mutual tls",
+			mqtt:              config.Mqtt{CACert: pki.caPath, ServerName: pki.serverName, ClientCert: pki.certPath, ClientKey: pki.keyPath},
+			requireClientCert: true,
+		},
+		{
+			name:              "mutual tls without client certificate",
+			mqtt:              config.Mqtt{CACert: pki.caPath, ServerName: pki.serverName},
+			requireClientCert: true,
+			wantErr:           true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := startTLSBroker(t, pki, tt.requireClientCert)
+			cfg, err := mqttTLSConfig(tt.mqtt)
+			if err != nil {
+				t.Fatalf("mqttTLSConfig() error = %v", err)
+			}
+			err = broker.dial(cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("handshake error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMqttTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	if err := os.WriteFile(empty, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		mqtt    config.Mqtt
+		wantErr string
+	}{
+		{
+			name:    "only client cert",
+			mqtt:    config.Mqtt{ClientCert: pki.certPath},
+			wantErr: "client_cert and client_key must be set together",
+		},
+		{
+			name:    "only client key",
+			mqtt:    config.Mqtt{ClientKey: pki.keyPath},
+			wantErr: "client_cert and client_key must be set together",
+		},
+		{
+			name:    "missing ca file",
+			mqtt:    config.Mqtt{CACert: filepath.Join(t.TempDir(), "missing.pem")},
+			wantErr: "reading mqtt ca_cert",
+		},
+		{
+			name:    "ca without certificates",
+			mqtt:    config.Mqtt{CACert: empty},
+			wantErr: "no certificates found",
+		},
+		{
+			name:    "key of another certificate",
+			mqtt:    config.Mqtt{ClientCert: pki.certPath, ClientKey: pki.caPath},
+			wantErr: "loading mqtt client certificate",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := mqttTLSConfig(tt.mqtt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("mqttTLSConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMqttOptionsConnectsOverTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	broker := startTLSBroker(t, pki, true)
+
+	opts, err := mqttOptions(config.Mqtt{
+		Host:       broker.host,
+		Port:       broker.port,
+		Scheme:     "ssl",
+		CACert:     pki.caPath,
+		ServerName: pki.serverName,
+		ClientCert: pki.certPath,
+		ClientKey:  pki.keyPath,
+	})
+	if err != nil {
+		t.Fatalf("mqttOptions() error = %v", err)
+	}
+	client := pahomqtt.NewClient(opts.SetAutoReconnect(false).SetConnectTimeout(5 * time.Second))
+	token := client.Connect()
+	if !token.WaitTimeout(10 * time.Second) {
+		t.Fatal("connect timed out")
+	}
+	if err := token.Error(); err != nil {
+		t.Fatalf("connect error = %v", err)
+	}
+	client.Disconnect(0)
+}
+
+func TestMqttOptionsRejectsInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		mqtt config.Mqtt
+	}{
+		{name: "unknown scheme", mqtt: config.Mqtt{Scheme: "quic"}},
+		{name: "state qos", mqtt: config.Mqtt{StateQoS: 3}},
+		{name: "command qos", mqtt: config.Mqtt{CommandQoS: 3}},
+		{name: "tls with half a client certificate", mqtt: config.Mqtt{Scheme: "ssl", ClientCert: "client.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := mqttOptions(tt.mqtt); err == nil {
+				t.Fatal("mqttOptions() error = nil, want an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/ha"
+	"github.com/billbatista/ha-daikin-smart-ac-br/locale"
+)
+
+// haOptions maps the mqtt configuration and locale to the entity publishing
+// options.
+func haOptions(c *config.Config) ha.Options {
+	cfg := c.Mqtt
+	loc, _ := locale.Parse(c.Locale)
+	return ha.Options{
+		BaseTopic:            cfg.BaseTopic,
+		DiscoveryPrefix:      cfg.DiscoveryPrefix,
+		StateQoS:             cfg.StateQoS,
+		CommandQoS:           cfg.CommandQoS,
+		RetainState:          cfg.RetainState,
+		HeartbeatInterval:    cfg.StateHeartbeat,
+		PublishUnknownFields: cfg.PublishUnknownFields,
+		Locale:               loc,
+	}
+}
+
+// pollOptions merges the global polling configuration with the device one.
+func pollOptions(cfg config.Polling, device config.Devices) ha.PollOptions {
+	opts := ha.PollOptions{
+		Interval:            cfg.Interval,
+		FastInterval:        cfg.FastInterval,
+		FastWindow:          cfg.FastWindow,
+		IdleInterval:        cfg.IdleInterval,
+		UnreachableInterval: cfg.UnreachableInterval,
+		UnreachableTimeout:  cfg.UnreachableTimeout,
+		StatusInterval:      cfg.StatusInterval,
+		Jitter:              ha.DefaultPollOptions.Jitter,
+	}
+	if cfg.Jitter != nil {
+		opts.Jitter = *cfg.Jitter
+	}
+	if device.PollInterval > 0 {
+		opts.Interval = device.PollInterval
+	}
+	return opts
+}
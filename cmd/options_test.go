@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/ha"
+)
+
+func TestPollOptions(t *testing.T) {
+	zero, half := 0.0, 0.5
+	tests := []struct {
+		name         string
+		polling      config.Polling
+		device       config.Devices
+		wantJitter   float64
+		wantInterval time.Duration
+	}{
+		{name: "unset jitter uses the default", wantJitter: ha.DefaultPollOptions.Jitter},
+		{name: "zero jitter disables it", polling: config.Polling{Jitter: &zero}, wantJitter: 0},
+		{name: "jitter", polling: config.Polling{Jitter: &half}, wantJitter: 0.5},
+		{
+			name:         "device interval overrides the global one",
+			polling:      config.Polling{Interval: 10 * time.Second},
+			device:       config.Devices{PollInterval: 2 * time.Second},
+			wantJitter:   ha.DefaultPollOptions.Jitter,
+			wantInterval: 2 * time.Second,
+		},
+		{
+			name:         "global interval",
+			polling:      config.Polling{Interval: 10 * time.Second},
+			wantJitter:   ha.DefaultPollOptions.Jitter,
+			wantInterval: 10 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pollOptions(tt.polling, tt.device)
+			if got.Jitter != tt.wantJitter {
+				t.Errorf("Jitter = %v, want %v", got.Jitter, tt.wantJitter)
+			}
+			if got.Interval != tt.wantInterval {
+				t.Errorf("Interval = %v, want %v", got.Interval, tt.wantInterval)
+			}
+		})
+	}
+}
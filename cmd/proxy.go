@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// proxyCommand listens like an AC, forwards every request to the real one and
+// records the decrypted traffic, so the official app can be pointed at it.
+func proxyCommand(ctx context.Context, args []string) error {
+	fs, flags := newDeviceFlagSet("proxy")
+	var (
+		listen  = fs.String("listen", ":15914", "address to listen on")
+		logPath = fs.String("log", "traffic.jsonl", "file the decrypted request and response pairs are appended to")
+	)
+	args, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	address, key, _, err := flags.device(ctx, args)
+	if err != nil {
+		return err
+	}
+	target, err := url.Parse(address)
+	if err != nil || target.Host == "" {
+		return fmt.Errorf("invalid address %q, expected something like http://192.168.0.15:15914", address)
+	}
+	secretKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("invalid secret key: %w", err)
+	}
+
+	file, err := os.OpenFile(*logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening traffic log: %w", err)
+	}
+	defer file.Close()
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(file)
+	record := func(e daikin.Exchange) {
+		slog.Info("proxied request", slog.String("method", e.Method), slog.String("path", e.Path), slog.Int("status", e.Status), slog.String("error", e.Error))
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(e); err != nil {
+			slog.Error("failed to write traffic log", slog.Any("error", err))
+		}
+	}
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           daikin.NewProxy(target, secretKey, record),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("proxying", slog.String("listen", *listen), slog.String("target", address), slog.String("log", *logPath))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
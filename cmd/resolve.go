@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/netip"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+const (
+	// rediscoverAfter is how many requests in a row must fail before the AC is
+	// looked for elsewhere.
+	rediscoverAfter = 3
+	// rediscoverEvery limits the scans made for the same AC.
+	rediscoverEvery = 5 * time.Minute
+	// rediscoverTimeout bounds a scan, including the time spent waiting for the
+	// scans of other ACs.
+	rediscoverTimeout = 2 * time.Minute
+)
+
+// rediscoverer is the part of daikin.Client used to look for an AC.
+type rediscoverer interface {
+	Target() *url.URL
+	Rediscover(ctx context.Context, opts daikin.DiscoverOptions) (*url.URL, error)
+}
+
+// resolver finds the ACs that stopped answering at their address, usually
+// after a DHCP renewal, and keeps the addresses found in the state file.
+type resolver struct {
+	options config.Rediscovery
+	path    string
+	// scans serializes the scans, so several unreachable ACs do not flood the
+	// network.
+	scans chan struct{}
+	// ctx is cancelled by close, stopping the scans, and wg tracks the scans
+	// started in the background.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// mu guards state and the state file writes.
+	mu    sync.Mutex
+	state *config.State
+}
+
+// newResolver creates the resolver for cfg, whose scans stop when ctx is done
+// or it is closed.
+func newResolver(ctx context.Context, cfg *config.Config, configPath string) *resolver {
+	r := &resolver{options: cfg.Rediscovery, path: config.StatePath(cfg, configPath), scans: make(chan struct{}, 1)}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	state, err := config.LoadState(r.path)
+	if err != nil {
+		slog.Error("failed to load state file, ignoring it", slog.Any("error", err))
+		state = &config.State{Devices: make(map[string]config.DeviceState)}
+	}
+	r.state = state
+	return r
+}
+
+// close stops the scans and waits for the ones started in the background, so
+// a resolver replaced on reload does not write the state file afterwards.
+func (r *resolver) close() {
+	r.mu.Lock()
+	r.cancel()
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+// background runs scan in a goroutine tracked by close, reporting false when
+// the resolver is already closed.
+func (r *resolver) background(scan func(ctx context.Context)) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		scan(r.ctx)
+	}()
+	return true
+}
+
+// address returns the address to reach the device at.
+func (r *resolver) address(d config.Devices) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.Address(d)
+}
+
+// client wraps the client of the device so it is looked for on the network
+// once it stops answering.
+func (r *resolver) client(d config.Devices, client *daikin.Client) *resolvingClient {
+	return &resolvingClient{Client: client, scanner: client, resolver: r, device: d}
+}
+
+// rediscover looks for the device, first at the address its MAC has in the ARP
+// table and then on the configured subnets, and switches client to it. A
+// device configured without an address is still looked up by its MAC when
+// rediscovery is disabled. The scan gives up after rediscoverTimeout, or when
+// ctx is done or the resolver closed.
+func (r *resolver) rediscover(ctx context.Context, d config.Devices, client rediscoverer) bool {
+	if r.options.Disabled && d.Address != "" {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, rediscoverTimeout)
+	defer cancel()
+	defer context.AfterFunc(r.ctx, cancel)()
+	if ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case r.scans <- struct{}{}:
+		defer func() { <-r.scans }()
+	case <-ctx.Done():
+		return false
+	}
+
+	previous := client.Target().String()
+	if client.Target().Host == "" {
+		previous = ""
+		slog.InfoContext(ctx, "ac has no address - looking for it on the network", slog.String("device", d.UniqueId))
+	} else {
+		slog.InfoContext(ctx, "ac not answering - looking for it on the network", slog.String("device", d.UniqueId), slog.String("address", previous))
+	}
+
+	var attempts [][]netip.Prefix
+	if mac, err := net.ParseMAC(d.Mac); err == nil {
+		if addr, ok := daikin.LookupMAC(mac); ok {
+			attempts = append(attempts, []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())})
+		}
+	}
+	if !r.options.Disabled {
+		var subnets []netip.Prefix
+		for _, subnet := range r.options.Subnets {
+			if prefix, err := netip.ParsePrefix(subnet); err == nil {
+				subnets = append(subnets, prefix)
+			}
+		}
+		// nil scans the local subnets
+		attempts = append(attempts, subnets)
+	}
+
+	for _, subnets := range attempts {
+		target, err := client.Rediscover(ctx, daikin.DiscoverOptions{Subnets: subnets})
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to scan for ac", slog.String("device", d.UniqueId), slog.Any("error", err))
+			return false
+		}
+		if target != nil {
+			return r.found(ctx, d, previous, target)
+		}
+	}
+	slog.WarnContext(ctx, "ac not found on the network", slog.String("device", d.UniqueId))
+	return false
+}
+
+// found persists the address the device was found at, reporting false when
+// the resolver was closed meanwhile.
+func (r *resolver) found(ctx context.Context, d config.Devices, previous string, target *url.URL) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ctx.Err() != nil {
+		return false
+	}
+	slog.InfoContext(ctx, "ac found", slog.String("device", d.UniqueId), slog.String("previous", previous), slog.String("address", target.String()))
+	r.state.SetAddress(d, target.String())
+	if err := r.state.Save(r.path); err != nil {
+		slog.ErrorContext(ctx, "failed to save state file", slog.String("path", r.path), slog.Any("error", err))
+	}
+	return true
+}
+
+// resolvingClient rediscovers the AC after rediscoverAfter requests in a row
+// failed because it was unreachable. The scan runs in the background so the
+// poller keeps its schedule.
+type resolvingClient struct {
+	*daikin.Client
+	// scanner looks for the AC, the client itself outside of tests.
+	scanner  rediscoverer
+	resolver *resolver
+	device   config.Devices
+	failures atomic.Int32
+	lastScan atomic.Int64
+	scanning atomic.Bool
+}
+
+func (c *resolvingClient) State(ctx context.Context) (*daikin.State, error) {
+	state, err := c.Client.State(ctx)
+	c.check(err)
+	return state, err
+}
+
+func (c *resolvingClient) SetState(ctx context.Context, desired daikin.DesiredState) (*daikin.State, error) {
+	state, err := c.Client.SetState(ctx, desired)
+	c.check(err)
+	return state, err
+}
+
+func (c *resolvingClient) check(err error) {
+	if !errors.Is(err, daikin.ErrUnreachable) {
+		c.failures.Store(0)
+		return
+	}
+	if c.failures.Add(1) < rediscoverAfter || time.Since(time.Unix(0, c.lastScan.Load())) < rediscoverEvery {
+		return
+	}
+	if !c.scanning.CompareAndSwap(false, true) {
+		return
+	}
+	c.lastScan.Store(time.Now().UnixNano())
+	// the request that failed may be cancelled as soon as check returns, e.g.
+	// a command or an API call, so the scan is bound to the resolver instead
+	started := c.resolver.background(func(ctx context.Context) {
+		defer c.scanning.Store(false)
+		if c.resolver.rediscover(ctx, c.device, c.scanner) {
+			c.failures.Store(0)
+		}
+	})
+	if !started {
+		c.scanning.Store(false)
+	}
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// fakeScanner finds the AC at found, or fails with err, recording the scans.
+type fakeScanner struct {
+	mu     sync.Mutex
+	target *url.URL
+	found  *url.URL
+	err    error
+	scans  [][]netip.Prefix
+}
+
+func (f *fakeScanner) Target() *url.URL {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.target
+}
+
+func (f *fakeScanner) Rediscover(_ context.Context, opts daikin.DiscoverOptions) (*url.URL, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scans = append(f.scans, opts.Subnets)
+	if f.found != nil {
+		f.target = f.found
+	}
+	return f.found, f.err
+}
+
+func (f *fakeScanner) scanCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.scans)
+}
+
+func newTestResolver(t *testing.T, rediscovery config.Rediscovery) *resolver {
+	t.Helper()
+	if rediscovery.StatePath == "" {
+		rediscovery.StatePath = filepath.Join(t.TempDir(), config.StateFileName)
+	}
+	r := newResolver(context.Background(), &config.Config{Rediscovery: rediscovery}, "")
+	t.Cleanup(r.close)
+	return r
+}
+
+func mustParseURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestResolverRediscover(t *testing.T) {
+	const (
+		configured = "http://192.168.0.15:15914"
+		moved      = "http://192.168.0.20:15914"
+	)
+	tests := []struct {
+		name        string
+		rediscovery config.Rediscovery
+		address     string
+		found       string
+		err         error
+		want        bool
+		wantScans   int
+		wantAddress string
+	}{
+		{
+			name:        "found",
+			rediscovery: config.Rediscovery{Subnets: []string{"192.168.0.0/24"}},
+			address:     configured,
+			found:       moved,
+			want:        true,
+			wantScans:   1,
+			wantAddress: moved,
+		},
+		{
+			name:        "not found",
+			address:     configured,
+			wantScans:   1,
+			wantAddress: configured,
+		},
+		{
+			name:        "scan fails",
+			address:     configured,
+			err:         errors.New("no local subnet"),
+			wantScans:   1,
+			wantAddress: configured,
+		},
+		{
+			name:        "disabled",
+			rediscovery: config.Rediscovery{Disabled: true},
+			address:     configured,
+			found:       moved,
+			wantAddress: configured,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestResolver(t, tt.rediscovery)
+			d := config.Devices{UniqueId: "Sala", Address: tt.address}
+			scanner := &fakeScanner{target: mustParseURL(t, tt.address), err: tt.err}
+			if tt.found != "" {
+				scanner.found = mustParseURL(t, tt.found)
+			}
+
+			if got := r.rediscover(context.Background(), d, scanner); got != tt.want {
+				t.Fatalf("rediscover() = %v, want %v", got, tt.want)
+			}
+			if got := scanner.scanCount(); got != tt.wantScans {
+				t.Fatalf("scanned %d times, want %d", got, tt.wantScans)
+			}
+			if got := r.address(d); got != tt.wantAddress {
+				t.Fatalf("address() = %q, want %q", got, tt.wantAddress)
+			}
+		})
+	}
+}
+
+func TestResolverScansTheConfiguredSubnets(t *testing.T) {
+	r := newTestResolver(t, config.Rediscovery{Subnets: []string{"192.168.0.0/24", "10.0.0.0/16"}})
+	scanner := &fakeScanner{target: mustParseURL(t, "http://192.168.0.15:15914")}
+	r.rediscover(context.Background(), config.Devices{UniqueId: "sala", Address: "http://192.168.0.15:15914"}, scanner)
+
+	want := []netip.Prefix{netip.MustParsePrefix("192.168.0.0/24"), netip.MustParsePrefix("10.0.0.0/16")}
+	if len(scanner.scans) != 1 || len(scanner.scans[0]) != len(want) || scanner.scans[0][0] != want[0] || scanner.scans[0][1] != want[1] {
+		t.Fatalf("scanned %v, want %v", scanner.scans, want)
+	}
+}
+
+func TestResolverStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), config.StateFileName)
+	d := config.Devices{UniqueId: "Sala", Address: "http://192.168.0.15:15914"}
+	r := newTestResolver(t, config.Rediscovery{StatePath: path})
+	scanner := &fakeScanner{target: mustParseURL(t, d.Address), found: mustParseURL(t, "http://192.168.0.20:15914")}
+	if !r.rediscover(context.Background(), d, scanner) {
+		t.Fatal("rediscover() = false, want true")
+	}
+
+	reloaded := newTestResolver(t, config.Rediscovery{StatePath: path})
+	if got := reloaded.address(d); got != "http://192.168.0.20:15914" {
+		t.Fatalf("address() after reload = %q, want the address found", got)
+	}
+	// editing the address in the config discards the one found
+	edited := d
+	edited.Address = "http://192.168.0.30:15914"
+	if got := reloaded.address(edited); got != edited.Address {
+		t.Fatalf("address() after editing the config = %q, want %q", got, edited.Address)
+	}
+}
+
+func TestResolverClosedDoesNotSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), config.StateFileName)
+	d := config.Devices{UniqueId: "sala", Address: "http://192.168.0.15:15914"}
+	r := newTestResolver(t, config.Rediscovery{StatePath: path})
+	r.close()
+
+	scanner := &fakeScanner{target: mustParseURL(t, d.Address), found: mustParseURL(t, "http://192.168.0.20:15914")}
+	if r.rediscover(context.Background(), d, scanner) {
+		t.Fatal("rediscover() = true on a closed resolver")
+	}
+	state, err := config.LoadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := state.Address(d); got != d.Address {
+		t.Fatalf("state file address = %q after close, want none saved", got)
+	}
+}
+
+func TestResolvingClientRediscoversAfterFailures(t *testing.T) {
+	r := newTestResolver(t, config.Rediscovery{})
+	d := config.Devices{UniqueId: "sala", SecretKey: "MDEyMzQ1Njc4OWFiY2RlZg=="}
+	// without an address every request fails as unreachable right away
+	client, err := newDaikinClient("", d.SecretKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := &fakeScanner{target: client.Target()}
+	c := r.client(d, client)
+	c.scanner = scanner
+	poll := func() {
+		t.Helper()
+		if _, err := c.State(context.Background()); !errors.Is(err, daikin.ErrUnreachable) {
+			t.Fatalf("State() error = %v, want ErrUnreachable", err)
+		}
+		r.wg.Wait()
+	}
+
+	for range rediscoverAfter - 1 {
+		poll()
+	}
+	if got := scanner.scanCount(); got != 0 {
+		t.Fatalf("scanned after %d failures, want none before %d", rediscoverAfter-1, rediscoverAfter)
+	}
+	poll()
+	if got := scanner.scanCount(); got != 1 {
+		t.Fatalf("scanned %d times after %d failures, want 1", got, rediscoverAfter)
+	}
+
+	// the failures go on, but the last scan is too recent
+	for range rediscoverAfter {
+		poll()
+	}
+	if got := scanner.scanCount(); got != 1 {
+		t.Fatalf("scanned %d times within rediscoverEvery, want 1", got)
+	}
+
+	c.lastScan.Store(time.Now().Add(-rediscoverEvery).UnixNano())
+	poll()
+	if got := scanner.scanCount(); got != 2 {
+		t.Fatalf("scanned %d times once rediscoverEvery elapsed, want 2", got)
+	}
+}
+
+func TestResolvingClientResetsFailuresOnSuccess(t *testing.T) {
+	r := newTestResolver(t, config.Rediscovery{})
+	c := r.client(config.Devices{UniqueId: "sala"}, nil)
+	c.scanner = &fakeScanner{target: &url.URL{}}
+
+	c.check(daikin.ErrUnreachable)
+	c.check(daikin.ErrUnreachable)
+	c.check(nil)
+	if got := c.failures.Load(); got != 0 {
+		t.Fatalf("failures = %d after a success, want 0", got)
+	}
+}
@@ -2,90 +2,471 @@ package cmd
 
 import (
 	"context"
-	"encoding/base64"
-	"fmt"
+	"crypto/sha256"
 	"log/slog"
-	"net/url"
+	"maps"
+	"net/http"
 	"os"
 	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/billbatista/ha-daikin-smart-ac-br/config"
 	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
 	"github.com/billbatista/ha-daikin-smart-ac-br/ha"
+	"github.com/billbatista/ha-daikin-smart-ac-br/locale"
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-func Server(ctx context.Context) error {
-	config, err := config.NewConfig("./config.yaml")
+const configWatchInterval = 5 * time.Second
+
+// parkedRecheckInterval is how often an AC answering with a wrong key or like
+// something other than an AC is probed again. Fixing the config restarts it
+// right away, so this only covers changes on the AC side.
+const parkedRecheckInterval = 5 * time.Minute
+
+// server owns the MQTT connection and the climates created from the config,
+// and applies configuration changes without restarting.
+type server struct {
+	configPath string
+	config     *config.Config
+	checksum   [sha256.Size]byte
+	mqtt       pahomqtt.Client
+	bridge     *ha.Bridge
+	scheduler  *ha.Scheduler
+	resolver   *resolver
+	metrics    *deviceMetrics
+	health     *deviceHealth
+	http       *http.Server
+	devices    map[string]*device
+	// devicesMu guards the writes to devices, which the API handlers read from
+	// other goroutines.
+	devicesMu sync.RWMutex
+	// connected is the bridge of the current MQTT connection, read by the
+	// HTTP handlers.
+	connected atomic.Pointer[ha.Bridge]
+	// ready is set once the config is loaded and the devices added, without
+	// waiting for the ACs to answer their probes.
+	ready atomic.Bool
+}
+
+type device struct {
+	config  config.Devices
+	climate *ha.Climate
+	// cancel stops the probe started by startDevice and the recheck of a
+	// parked device, and done is closed once they returned.
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop stops the probe or the recheck, if any, and then the climate.
+func (d *device) stop() {
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+	}
+	d.climate.Stop()
+}
+
+func Server(ctx context.Context, configPath string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s := &server{
+		configPath: configPath,
+		devices:    make(map[string]*device),
+	}
+
+	checksum, err := s.fileChecksum()
+	if err != nil {
+		return err
+	}
+	config, err := config.Load(ctx, configPath)
+	if err != nil {
+		return err
+	}
+	s.config, s.checksum = config, checksum
+	s.resolver = newResolver(ctx, config, configPath)
+	s.metrics = newDeviceMetrics(func() bool {
+		bridge := s.connected.Load()
+		return bridge != nil && bridge.Connected()
+	})
+	s.health = newDeviceHealth()
+	s.startHTTP()
+	defer s.stopHTTP()
+
+	if err := s.connect(); err != nil {
+		return err
+	}
+	s.scheduler = ha.NewScheduler(config.Polling.MaxConcurrent)
+	for _, d := range config.Devices {
+		if err := s.startDevice(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	s.ready.Store(true)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	watch := time.NewTicker(configWatchInterval)
+	defer watch.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("signal caught - exiting")
+			s.shutdown()
+			slog.Info("shutdown complete")
+			return nil
+		case <-hup:
+			slog.Info("SIGHUP received - reloading config")
+			s.reload(ctx, true)
+		case <-watch.C:
+			s.reload(ctx, false)
+		}
+	}
+}
+
+// connect creates the MQTT client for the current config and connects to the broker.
+func (s *server) connect() error {
+	bridge, client, err := dial(s.config)
 	if err != nil {
 		return err
 	}
+	s.bridge, s.mqtt = bridge, client
+	s.connected.Store(bridge)
+	return nil
+}
 
-	mqttClient := pahomqtt.NewClient(
-		pahomqtt.NewClientOptions().
-			AddBroker(fmt.Sprintf("tcp://%s:%s", config.Mqtt.Host, config.Mqtt.Port)).
-			SetUsername(config.Mqtt.Username).
-			SetPassword(config.Mqtt.Password),
-	)
-	if token := mqttClient.Connect(); token.Wait() && token.Error() != nil {
+// dial creates a MQTT client for cfg and connects it to the broker.
+func dial(cfg *config.Config) (*ha.Bridge, pahomqtt.Client, error) {
+	mqttOpts, err := mqttOptions(cfg.Mqtt)
+	if err != nil {
+		slog.Error("invalid mqtt configuration", slog.Any("error", err))
+		return nil, nil, err
+	}
+	bridge := ha.NewBridge(haOptions(cfg))
+	client := pahomqtt.NewClient(bridge.Configure(mqttOpts))
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		slog.Error("failed to connect", slog.Any("error", token.Error()))
-		return token.Error()
+		return nil, nil, token.Error()
 	}
-	slog.Info("connected to mqtt")
+	return bridge, client, nil
+}
 
-	defer func() {
-		slog.Info("signal caught - exiting")
-		mqttClient.Disconnect(1000)
-		slog.Info("shutdown complete")
-	}()
+// startDevice publishes the climate for the given device and probes it in the
+// background, so an AC slow to answer holds back neither the others nor the
+// readiness of the bridge. An AC that is off or unreachable is then polled at
+// the unreachable interval until it answers, while one whose /acstatus answers
+// with a wrong key or not like an AC is parked and only probed again every
+// parkedRecheckInterval.
+func (s *server) startDevice(ctx context.Context, d config.Devices) error {
+	client, err := newDaikinClient(s.resolver.address(d), d.SecretKey)
+	if err != nil {
+		slog.Error("invalid device", slog.Any("error", err), slog.String("device", d.UniqueId))
+		return err
+	}
+	client.SetRequestHook(s.metrics.requestHook(deviceKey(d)))
+	metered := &meteredClient{resolvingClient: s.resolver.client(d, client), metrics: s.metrics, health: s.health, device: deviceKey(d)}
+	ac := ha.NewClimate(metered, s.mqtt, d.Name, d.UniqueId, d.OperationModes, d.FanModes, haOptions(s.config)).
+		WithPolling(s.scheduler, pollOptions(s.config.Polling, d))
+	ac.PublishDiscovery()
+	dev := &device{config: d, climate: ac}
+	s.devicesMu.Lock()
+	s.devices[deviceKey(d)] = dev
+	s.devicesMu.Unlock()
+	s.health.track(deviceKey(d), d)
+	s.bridge.Add(ac)
 
-	for _, d := range config.Devices {
-		url, err := url.Parse(d.Address)
-		if err != nil {
-			slog.Error("invalid target address", slog.Any("error", err), slog.String("address", d.Address))
-			return err
+	loc, _ := locale.Parse(s.config.Locale)
+	ctx, dev.cancel = context.WithCancel(ctx)
+	dev.done = make(chan struct{})
+	go s.bringUp(ctx, dev, client, s.resolver, loc)
+	return nil
+}
+
+// bringUp probes a device added by startDevice, looking for it on the network
+// first when needed, and then starts polling it or parks it.
+func (s *server) bringUp(ctx context.Context, d *device, client *daikin.Client, resolver *resolver, loc locale.Locale) {
+	defer close(d.done)
+
+	// a device without an address, configured or found before, is looked
+	// for before probing it
+	scanned := client.Target().Host == ""
+	if scanned {
+		resolver.rediscover(ctx, d.config, client)
+	}
+	result := client.Probe(ctx)
+	if result.Diagnosis == daikin.DiagnosisUnreachable && !scanned && resolver.rediscover(ctx, d.config, client) {
+		result = client.Probe(ctx)
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	d.climate.PublishDiagnosis(ctx, result)
+	if result.Err != nil {
+		slog.Error("ac probe failed", slog.String("device", d.config.UniqueId), slog.String("diagnosis", string(result.Diagnosis)), slog.String("message", loc.Text("diagnosis."+string(result.Diagnosis))), slog.String("endpoint", result.Endpoint), slog.Any("error", result.Err))
+	}
+	if parked(result) {
+		d.climate.PublishUnavailable(ctx)
+		s.recheck(ctx, d, client)
+		return
+	}
+	d.climate.Start(ctx)
+}
+
+// parked reports whether polling an AC probed with the given result is
+// pointless until the config or the AC changes. Only /acstatus matters, as a
+// /status failing alone still leaves the AC controllable.
+func parked(result daikin.ProbeResult) bool {
+	return result.Endpoint == "/acstatus" && (result.Diagnosis == daikin.DiagnosisWrongKey || result.Diagnosis == daikin.DiagnosisWrongEndpoint)
+}
+
+// recheck probes a parked device every parkedRecheckInterval, starting it once
+// it answers like an AC with the configured key.
+func (s *server) recheck(ctx context.Context, d *device, client *daikin.Client) {
+	ticker := time.NewTicker(parkedRecheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		secretKey, err := base64.StdEncoding.DecodeString(d.SecretKey)
-		if err != nil {
-			slog.Error("invalid secret key", slog.Any("error", err), slog.String("secretKey", d.SecretKey))
-			return err
+		result := client.Probe(ctx)
+		if ctx.Err() != nil {
+			return
 		}
-		client := daikin.NewClient(url, secretKey)
-		ac := ha.NewClimate(client, mqttClient, d.Name, d.UniqueId, d.OperationModes, d.FanModes)
+		d.climate.PublishDiagnosis(ctx, result)
+		if parked(result) {
+			continue
+		}
+		slog.Info("parked ac answered - starting it", slog.String("device", d.config.UniqueId), slog.String("diagnosis", string(result.Diagnosis)))
+		d.climate.Start(ctx)
+		return
+	}
+}
 
-		var wg sync.WaitGroup
+// stopDevice stops polling the device and publishes it as offline.
+func (s *server) stopDevice(key string) {
+	d, ok := s.devices[key]
+	if !ok {
+		return
+	}
+	s.bridge.Remove(d.climate)
+	d.stop()
+	s.devicesMu.Lock()
+	delete(s.devices, key)
+	s.devicesMu.Unlock()
+}
+
+// stopAll stops every device concurrently.
+func (s *server) stopAll() {
+	var wg sync.WaitGroup
+	for _, d := range s.devices {
 		wg.Add(1)
 		go func() {
-			ac.PublishDiscovery()
-			wg.Done()
+			defer wg.Done()
+			s.bridge.Remove(d.climate)
+			d.stop()
 		}()
-		wg.Wait()
+	}
+	wg.Wait()
+	s.devicesMu.Lock()
+	clear(s.devices)
+	s.devicesMu.Unlock()
+}
+
+func (s *server) shutdown() {
+	s.stopAll()
+	s.resolver.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.bridge.PublishOffline(ctx, s.mqtt)
+	s.mqtt.Disconnect(1000)
+}
+
+// reload applies the config file when it changed since it was last loaded, or
+// unconditionally when force is set. An invalid config is logged and ignored,
+// keeping the running devices untouched.
+func (s *server) reload(ctx context.Context, force bool) {
+	checksum, err := s.fileChecksum()
+	if err != nil {
+		slog.Error("failed to read config file", slog.Any("error", err))
+		return
+	}
+	if !force && checksum == s.checksum {
+		return
+	}
+	s.checksum = checksum
+
+	cfg, err := config.Load(ctx, s.configPath)
+	if err != nil {
+		slog.Error("config changed but is invalid - keeping the running one", slog.Any("error", err))
+		return
+	}
+	slog.Info("config changed - applying")
+	s.apply(ctx, cfg)
+}
+
+// apply diffs cfg against the running config, reconnecting to MQTT only when the
+// broker settings changed and otherwise restarting only the devices that were
+// added, removed or edited.
+func (s *server) apply(ctx context.Context, cfg *config.Config) {
+	if !reflect.DeepEqual(s.config.Http, cfg.Http) {
+		slog.Info("http settings changed - restarting the http server")
+		s.stopHTTP()
+		s.config.Http = cfg.Http
+		s.startHTTP()
+	}
 
-		_, err = client.State(ctx)
-		if err != nil {
-			slog.Error("could not get ac state", slog.String("name", d.UniqueId))
-			ac.PublishUnavailable(ctx)
+	// a client whose reconnection failed is not retrying on its own
+	if !reflect.DeepEqual(s.config.Mqtt, cfg.Mqtt) || s.config.Locale != cfg.Locale || !s.mqtt.IsConnected() {
+		slog.Info("mqtt settings or locale changed - reconnecting")
+		s.reconnect(ctx, cfg)
+		return
+	}
+
+	restartAll := !reflect.DeepEqual(s.config.Polling, cfg.Polling) || !reflect.DeepEqual(s.config.Rediscovery, cfg.Rediscovery)
+	if restartAll {
+		s.scheduler = ha.NewScheduler(cfg.Polling.MaxConcurrent)
+		s.resolver.close()
+		s.resolver = newResolver(ctx, cfg, s.configPath)
+	}
+	s.config = cfg
+
+	wanted := make(map[string]config.Devices, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		wanted[deviceKey(d)] = d
+	}
+	for key, d := range s.devices {
+		if _, ok := wanted[key]; ok {
+			continue
 		}
+		slog.Info("device removed", slog.String("device", d.config.UniqueId))
+		s.stopDevice(key)
+		d.climate.RemoveDiscovery()
+		s.metrics.forget(key)
+		s.health.forget(key)
+	}
 
-		if err == nil {
-			go func() {
-				ac.PublishAvailable()
-				ac.StateUpdate(ctx)
-				ac.CommandSubscriptions()
-			}()
+	for _, d := range cfg.Devices {
+		key := deviceKey(d)
+		current, ok := s.devices[key]
+		switch {
+		case !ok:
+			slog.Info("device added", slog.String("device", d.UniqueId))
+		case restartAll || !reflect.DeepEqual(current.config, d):
+			slog.Info("device changed", slog.String("device", d.UniqueId))
+			s.stopDevice(key)
+		default:
+			continue
 		}
-		defer func() {
-			ac.PublishUnavailable(ctx)
-		}()
+		if err := s.startDevice(ctx, d); err != nil {
+			slog.Error("failed to start device", slog.String("device", d.UniqueId), slog.Any("error", err))
+		}
+	}
+}
+
+// reconnect switches the devices to a new MQTT connection for cfg. The current
+// connection keeps serving them until the new one is up, so a broker that
+// cannot be reached leaves the bridge as it was.
+func (s *server) reconnect(ctx context.Context, cfg *config.Config) {
+	// the broker drops the older of two connections with the same client id, so
+	// that one has to go first
+	exclusive := cfg.Mqtt.ClientId != "" && cfg.Mqtt.ClientId == s.config.Mqtt.ClientId
+	if exclusive {
+		s.retire(cfg)
+	}
+
+	bridge, client, err := dial(cfg)
+	if err != nil {
+		// retry on the next watch tick
+		s.checksum = [sha256.Size]byte{}
+		if exclusive {
+			slog.Info("restoring the previous mqtt connection")
+			if token := s.mqtt.Connect(); token.Wait() && token.Error() != nil {
+				slog.Error("failed to connect", slog.Any("error", token.Error()))
+				return
+			}
+			s.startDevices(ctx)
+		}
+		return
+	}
+	if !exclusive {
+		s.retire(cfg)
 	}
 
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-	signal.Notify(sig, syscall.SIGTERM)
+	s.config = cfg
+	s.bridge, s.mqtt = bridge, client
+	s.connected.Store(bridge)
+	s.resolver.close()
+	s.resolver = newResolver(ctx, cfg, s.configPath)
+	s.scheduler = ha.NewScheduler(cfg.Polling.MaxConcurrent)
+	s.startDevices(ctx)
+}
 
-	<-sig
+// retire stops the devices on the current connection, clears the discovery
+// configs cfg no longer publishes, using the topics they were published with,
+// and disconnects.
+func (s *server) retire(cfg *config.Config) {
+	previous := slices.Collect(maps.Values(s.devices))
+	wanted := make(map[string]bool, len(cfg.Devices))
+	for _, d := range cfg.Devices {
+		wanted[deviceKey(d)] = true
+	}
+	topicsChanged := s.config.Mqtt.BaseTopic != cfg.Mqtt.BaseTopic || s.config.Mqtt.DiscoveryPrefix != cfg.Mqtt.DiscoveryPrefix
 
-	return nil
+	s.stopAll()
+	for _, d := range previous {
+		key := deviceKey(d.config)
+		if !wanted[key] {
+			slog.Info("device removed", slog.String("device", d.config.UniqueId))
+			s.metrics.forget(key)
+			s.health.forget(key)
+		}
+		if topicsChanged || !wanted[key] {
+			d.climate.RemoveDiscovery()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if topicsChanged {
+		s.bridge.RemoveDiscovery(ctx, s.mqtt)
+		// with the same base topic the new connection publishes online itself
+		s.bridge.PublishOffline(ctx, s.mqtt)
+	}
+	s.mqtt.Disconnect(1000)
+}
+
+// startDevices starts every device of the current config.
+func (s *server) startDevices(ctx context.Context) {
+	for _, d := range s.config.Devices {
+		if err := s.startDevice(ctx, d); err != nil {
+			slog.Error("failed to start device", slog.String("device", d.UniqueId), slog.Any("error", err))
+		}
+	}
+}
+
+func (s *server) fileChecksum() ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(s.configPath)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// deviceKey identifies a device across reloads, matching the lower cased unique
+// id used by the climate.
+func deviceKey(d config.Devices) string {
+	return strings.ToLower(d.UniqueId)
 }
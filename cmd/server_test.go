@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+func TestParked(t *testing.T) {
+	tests := []struct {
+		name   string
+		result daikin.ProbeResult
+		want   bool
+	}{
+		{name: "ok", result: daikin.ProbeResult{Diagnosis: daikin.DiagnosisOK}},
+		{name: "unreachable", result: daikin.ProbeResult{Diagnosis: daikin.DiagnosisUnreachable, Endpoint: "/acstatus"}},
+		{name: "wrong key", result: daikin.ProbeResult{Diagnosis: daikin.DiagnosisWrongKey, Endpoint: "/acstatus"}, want: true},
+		{name: "wrong endpoint", result: daikin.ProbeResult{Diagnosis: daikin.DiagnosisWrongEndpoint, Endpoint: "/acstatus"}, want: true},
+		{name: "only status fails", result: daikin.ProbeResult{Diagnosis: daikin.DiagnosisWrongEndpoint, Endpoint: "/status"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parked(tt.result); got != tt.want {
+				t.Fatalf("parked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/config"
+)
+
+// Validate loads the configuration file and reports every problem found in it.
+func Validate(ctx context.Context, filePath string) error {
+	cfg, err := config.Load(ctx, filePath)
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, p := range validationErr.Problems {
+			fmt.Fprintf(os.Stdout, "%s: %s\n", filePath, p)
+		}
+		return fmt.Errorf("%s has %d problem(s)", filePath, len(validationErr.Problems))
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "%s is valid, %d device(s) configured\n", filePath, len(cfg.Devices))
+	return nil
+}
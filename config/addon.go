@@ -0,0 +1,110 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// AddonOptionsPath is where the Supervisor writes the add-on options.
+	AddonOptionsPath = "/data/options.json"
+	// DefaultSupervisorURL is the Supervisor API as seen from inside an add-on.
+	DefaultSupervisorURL = "http://supervisor"
+	supervisorTokenEnv   = "SUPERVISOR_TOKEN"
+)
+
+// IsAddon reports whether the bridge is running as a Home Assistant add-on.
+func IsAddon() bool {
+	if os.Getenv(supervisorTokenEnv) == "" {
+		return false
+	}
+	_, err := os.Stat(AddonOptionsPath)
+	return err == nil
+}
+
+// Supervisor is a minimal client of the Home Assistant Supervisor API.
+type Supervisor struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// NewSupervisor creates a *Supervisor using the token the Supervisor injects
+// in the add-on environment.
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		URL:        DefaultSupervisorURL,
+		Token:      os.Getenv(supervisorTokenEnv),
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// MqttService is the broker the Supervisor provides to add-ons declaring the
+// mqtt service, usually the Mosquitto add-on.
+type MqttService struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	SSL      bool   `json:"ssl"`
+	Protocol string `json:"protocol"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// MqttService fetches the MQTT service credentials.
+func (s *Supervisor) MqttService(ctx context.Context) (*MqttService, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL+"/services/mqtt", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.Token)
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("querying supervisor mqtt service: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("supervisor mqtt service returned status code %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Result  string      `json:"result"`
+		Message string      `json:"message"`
+		Data    MqttService `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding supervisor response: %w", err)
+	}
+	if body.Result != "ok" {
+		return nil, fmt.Errorf("supervisor mqtt service: %s", body.Message)
+	}
+	return &body.Data, nil
+}
+
+// NewAddonConfig reads the add-on options file, which has the same layout as
+// config.yaml in JSON. When the options do not set mqtt.host, the broker and
+// credentials are taken from the Supervisor mqtt service.
+func NewAddonConfig(ctx context.Context, optionsPath string, supervisor *Supervisor) (*Config, error) {
+	return load(optionsPath, func(c *Config) error {
+		if c.Mqtt.Host != "" {
+			return nil
+		}
+		svc, err := supervisor.MqttService(ctx)
+		if err != nil {
+			return err
+		}
+		c.Mqtt.Host = svc.Host
+		c.Mqtt.Port = strconv.Itoa(svc.Port)
+		c.Mqtt.Username = svc.Username
+		c.Mqtt.Password = svc.Password
+		if svc.SSL && c.Mqtt.Scheme == "" {
+			c.Mqtt.Scheme = "ssl"
+		}
+		return nil
+	})
+}
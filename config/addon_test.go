@@ -0,0 +1,145 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testAddonOptions = `{
+  %s
+  "devices": [
+    {
+      "name": "Sala",
+      "unique_id": "sala",
+      "address": "http://192.168.0.15:15914",
+      "secret_key": "MDEyMzQ1Njc4OWFiY2RlZg=="
+    }
+  ]
+}`
+
+// supervisorStandIn serves /services/mqtt with the given status and body,
+// counting the calls and checking the token.
+func supervisorStandIn(t *testing.T, status int, body string) (*Supervisor, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/services/mqtt" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			t.Errorf("Authorization = %q, want the supervisor token", got)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return &Supervisor{URL: srv.URL, Token: "test-token", HTTPClient: srv.Client()}, &calls
+}
+
+func writeAddonOptions(t *testing.T, mqtt string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "options.json")
+	data := strings.Replace(testAddonOptions, "%s", mqtt, 1)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewAddonConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		mqtt      string
+		status    int
+		body      string
+		wantErr   string
+		wantCalls int32
+		wantMqtt  Mqtt
+		checkMqtt bool
+	}{
+		{
+			name:      "broker from the supervisor",
+			status:    http.StatusOK,
+			body:      `{"result":"ok","data":{"host":"core-mosquitto","port":1883,"ssl":false,"username":"addons","password":"secret"}}`,
+			wantCalls: 1,
+			wantMqtt:  Mqtt{Host: "core-mosquitto", Port: "1883", Username: "addons", Password: "secret"},
+			checkMqtt: true,
+		},
+		{
+			name:      "ssl broker",
+			status:    http.StatusOK,
+			body:      `{"result":"ok","data":{"host":"core-mosquitto","port":8883,"ssl":true,"username":"addons","password":"secret"}}`,
+			wantCalls: 1,
+			wantMqtt:  Mqtt{Host: "core-mosquitto", Port: "8883", Username: "addons", Password: "secret", Scheme: "ssl"},
+			checkMqtt: true,
+		},
+		{
+			name:      "configured scheme is kept",
+			mqtt:      `"mqtt": {"scheme": "wss"},`,
+			status:    http.StatusOK,
+			body:      `{"result":"ok","data":{"host":"core-mosquitto","port":8884,"ssl":true,"username":"addons","password":"secret"}}`,
+			wantCalls: 1,
+			wantMqtt:  Mqtt{Host: "core-mosquitto", Port: "8884", Username: "addons", Password: "secret", Scheme: "wss"},
+			checkMqtt: true,
+		},
+		{
+			name:      "result not ok",
+			status:    http.StatusOK,
+			body:      `{"result":"error","message":"No mqtt service available"}`,
+			wantCalls: 1,
+			wantErr:   "No mqtt service available",
+		},
+		{
+			name:      "status not 200",
+			status:    http.StatusForbidden,
+			body:      `{"result":"error","message":"forbidden"}`,
+			wantCalls: 1,
+			wantErr:   "status code 403",
+		},
+		{
+			name:      "invalid body",
+			status:    http.StatusOK,
+			body:      `not json`,
+			wantCalls: 1,
+			wantErr:   "decoding supervisor response",
+		},
+		{
+			name:      "host set in the options",
+			mqtt:      `"mqtt": {"host": "broker.lan", "port": "1883", "username": "bridge"},`,
+			status:    http.StatusInternalServerError,
+			wantCalls: 0,
+			wantMqtt:  Mqtt{Host: "broker.lan", Port: "1883", Username: "bridge"},
+			checkMqtt: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			supervisor, calls := supervisorStandIn(t, tt.status, tt.body)
+			c, err := NewAddonConfig(context.Background(), writeAddonOptions(t, tt.mqtt), supervisor)
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("supervisor calls = %d, want %d", got, tt.wantCalls)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewAddonConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NewAddonConfig() error = %v", err)
+			}
+			if tt.checkMqtt {
+				assertEqual(t, c.Mqtt, tt.wantMqtt)
+			}
+			assertEqual(t, c.Devices[0].UniqueId, "sala")
+		})
+	}
+}
@@ -1,16 +1,109 @@
 package config
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Mqtt    Mqtt      `yaml:"mqtt"`
-	Devices []Devices `yaml:"devices"`
+	Mqtt    Mqtt    `yaml:"mqtt"`
+	Polling Polling `yaml:"polling,omitempty"`
+	// Locale is the language of the entity names and messages: pt-BR, en or es.
+	Locale string `yaml:"locale,omitempty"`
+	// Http serves the metrics, health checks and REST API, on
+	// DefaultHttpListen unless disabled.
+	Http Http `yaml:"http,omitempty"`
+	// Rediscovery finds the ACs again when their address changes.
+	Rediscovery Rediscovery `yaml:"rediscovery,omitempty"`
+	Devices     []Devices   `yaml:"devices"`
+}
+
+// Polling controls how often the ACs are queried. Zero values use the defaults.
+type Polling struct {
+	Interval            time.Duration `yaml:"interval,omitempty"`
+	FastInterval        time.Duration `yaml:"fast_interval,omitempty"`
+	FastWindow          time.Duration `yaml:"fast_window,omitempty"`
+	IdleInterval        time.Duration `yaml:"idle_interval,omitempty"`
+	UnreachableInterval time.Duration `yaml:"unreachable_interval,omitempty"`
+	// UnreachableTimeout bounds the requests to an AC that is not answering, so
+	// it does not hold a request slot for long.
+	UnreachableTimeout time.Duration `yaml:"unreachable_timeout,omitempty"`
+	StatusInterval     time.Duration `yaml:"status_interval,omitempty"`
+	// Jitter defaults to 0.2 when not set, 0 disables it.
+	Jitter *float64 `yaml:"jitter,omitempty"`
+	// MaxConcurrent caps the HTTP requests made to all ACs at the same time.
+	MaxConcurrent int `yaml:"max_concurrent,omitempty"`
+}
+
+// DefaultHttpListen is the address the HTTP server listens on when none is set.
+const DefaultHttpListen = ":8080"
+
+// Http controls the HTTP server exposing the metrics, health checks and API.
+type Http struct {
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Listen is the address to listen on, DefaultHttpListen when empty.
+	Listen string `yaml:"listen,omitempty"`
+	// Api serves the REST API controlling the ACs under /api.
+	Api bool `yaml:"api,omitempty"`
+	// Token, when set, must be sent by the API clients as a bearer token.
+	Token string `yaml:"token,omitempty"`
+	// TokenFile is read into Token, for Docker and Kubernetes secrets.
+	TokenFile string `yaml:"token_file,omitempty"`
+}
+
+// Address returns the address the HTTP server listens on, empty when it is
+// disabled.
+func (h Http) Address() string {
+	if h.Disabled {
+		return ""
+	}
+	if h.Listen == "" {
+		return DefaultHttpListen
+	}
+	return h.Listen
+}
+
+// HttpAddress returns the address the HTTP server of the config at filePath
+// listens on, like Http.Address, reading only the http section and its
+// environment overrides. Unlike Load it neither validates the config nor asks
+// the Supervisor for the broker, so it suits the frequent health checks.
+func HttpAddress(filePath string) (string, error) {
+	var config struct {
+		Http struct {
+			Disabled bool   `yaml:"disabled"`
+			Listen   string `yaml:"listen"`
+		} `yaml:"http"`
+	}
+	file, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open config file: %w", err)
+	}
+	if err := yaml.Unmarshal(file, &config); err != nil {
+		return "", fmt.Errorf("decoding config file: %w", err)
+	}
+	if err := overrideStruct(reflect.ValueOf(&config).Elem(), envPrefix); err != nil {
+		return "", err
+	}
+	return Http{Disabled: config.Http.Disabled, Listen: config.Http.Listen}.Address(), nil
+}
+
+// Rediscovery controls how an AC that stopped answering is looked for on the
+// network, matching the hosts found by its secret key.
+type Rediscovery struct {
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Subnets are scanned for the AC, e.g. 192.168.0.0/24. The local /24
+	// subnets are used when empty.
+	Subnets []string `yaml:"subnets,omitempty"`
+	// StatePath is the file the addresses found are kept in across restarts,
+	// state.json next to the config file by default.
+	StatePath string `yaml:"state_path,omitempty"`
 }
 
 type Mqtt struct {
@@ -18,18 +111,85 @@ type Mqtt struct {
 	Port     string `yaml:"port"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
+	// PasswordFile is read into Password, for Docker and Kubernetes secrets.
+	PasswordFile string `yaml:"password_file,omitempty"`
+	// Scheme is the transport used to reach the broker: tcp (default), ssl, ws or wss.
+	Scheme string `yaml:"scheme,omitempty"`
+	// Path is the websocket endpoint, only used by the ws and wss schemes.
+	Path               string `yaml:"path,omitempty"`
+	CACert             string `yaml:"ca_cert,omitempty"`
+	ClientCert         string `yaml:"client_cert,omitempty"`
+	ClientKey          string `yaml:"client_key,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	ServerName         string `yaml:"server_name,omitempty"`
+	// ClientId is the MQTT client identifier, a random one is used when empty.
+	ClientId string `yaml:"client_id,omitempty"`
+	// CleanSession defaults to true when not set.
+	CleanSession    *bool  `yaml:"clean_session,omitempty"`
+	StateQoS        byte   `yaml:"state_qos,omitempty"`
+	CommandQoS      byte   `yaml:"command_qos,omitempty"`
+	RetainState     bool   `yaml:"retain_state,omitempty"`
+	BaseTopic       string `yaml:"base_topic,omitempty"`
+	DiscoveryPrefix string `yaml:"discovery_prefix,omitempty"`
+	// StateHeartbeat is how often the full state is republished, e.g. "5m".
+	StateHeartbeat time.Duration `yaml:"state_heartbeat,omitempty"`
+	// PublishUnknownFields exposes undecoded firmware fields as a diagnostic sensor.
+	PublishUnknownFields bool `yaml:"publish_unknown_fields,omitempty"`
+}
+
+// BrokerURL returns the broker address in the format expected by paho.
+func (m Mqtt) BrokerURL() string {
+	scheme := m.Scheme
+	if scheme == "" {
+		scheme = "tcp"
+	}
+	broker := fmt.Sprintf("%s://%s:%s", scheme, m.Host, m.Port)
+	if (scheme == "ws" || scheme == "wss") && m.Path != "" {
+		broker += "/" + strings.TrimPrefix(m.Path, "/")
+	}
+	return broker
+}
+
+// UsesTLS reports whether the connection to the broker is encrypted.
+func (m Mqtt) UsesTLS() bool {
+	return m.Scheme == "ssl" || m.Scheme == "wss"
 }
 
 type Devices struct {
-	Name           string   `yaml:"name"`
-	Address        string   `yaml:"address"`
-	SecretKey      string   `yaml:"secret_key"`
-	UniqueId       string   `yaml:"unique_id"`
+	Name string `yaml:"name"`
+	// Address is optional when the AC can be found on the network, by its Mac
+	// or by scanning the subnets for its secret key.
+	Address   string `yaml:"address"`
+	SecretKey string `yaml:"secret_key"`
+	// SecretKeyFile is read into SecretKey, for Docker and Kubernetes secrets.
+	SecretKeyFile string `yaml:"secret_key_file,omitempty"`
+	UniqueId      string `yaml:"unique_id"`
+	// Mac is looked up in the ARP table to find the AC faster when it changes
+	// address.
+	Mac            string   `yaml:"mac,omitempty"`
 	OperationModes []string `yaml:"operation_modes,omitempty"`
 	FanModes       []string `yaml:"fan_modes,omitempty"`
+	// PollInterval overrides polling.interval for this device.
+	PollInterval time.Duration `yaml:"poll_interval,omitempty"`
 }
 
 func NewConfig(filePath string) (*Config, error) {
+	return load(filePath, nil)
+}
+
+// Load reads the config at filePath, using the Home Assistant add-on layout
+// when it points to the add-on options file.
+func Load(ctx context.Context, filePath string) (*Config, error) {
+	if filePath == AddonOptionsPath {
+		return NewAddonConfig(ctx, filePath, NewSupervisor())
+	}
+	return NewConfig(filePath)
+}
+
+// load reads and validates the config at filePath. When fill is not nil it is
+// called before applying the environment overrides, to complete the decoded
+// config from other sources.
+func load(filePath string, fill func(*Config) error) (*Config, error) {
 	config := &Config{}
 
 	file, err := os.ReadFile(filePath)
@@ -37,11 +197,25 @@ func NewConfig(filePath string) (*Config, error) {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
 
-	err = yaml.Unmarshal(file, &config)
+	root, problems, err := decode(file, config)
 	if err != nil {
 		slog.Error("failed to read config file", slog.Any("error", err))
 		return nil, err
 	}
 
+	if fill != nil {
+		if err := fill(config); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyOverrides(config); err != nil {
+		return nil, err
+	}
+
+	if err := config.validate(root, problems); err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
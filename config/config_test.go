@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHttpAddress(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		// data is the content of file.
+		data string
+		env  map[string]string
+		want string
+	}{
+		{
+			name: "default",
+			file: "config.yaml",
+			data: "mqtt:\n  host: localhost\n",
+			want: DefaultHttpListen,
+		},
+		{
+			name: "listen",
+			file: "config.yaml",
+			data: "http:\n  listen: 127.0.0.1:9090\n",
+			want: "127.0.0.1:9090",
+		},
+		{
+			name: "disabled",
+			file: "config.yaml",
+			data: "http:\n  disabled: true\n",
+			want: "",
+		},
+		{
+			name: "invalid config elsewhere",
+			file: "config.yaml",
+			data: "mqtt:\n  port: \"99999\"\nhttp:\n  listen: :9090\ndevices:\n  - unique_id: sala\n",
+			want: ":9090",
+		},
+		{
+			name: "environment",
+			file: "config.yaml",
+			data: "http:\n  listen: :9090\n",
+			env:  map[string]string{"DAIKIN_HTTP_LISTEN": ":7070"},
+			want: ":7070",
+		},
+		{
+			name: "disabled by the environment",
+			file: "config.yaml",
+			data: "http:\n  listen: :9090\n",
+			env:  map[string]string{"DAIKIN_HTTP_DISABLED": "true"},
+			want: "",
+		},
+		{
+			name: "add-on options",
+			file: "options.json",
+			data: `{"devices":[],"http":{"listen":":8099"}}`,
+			want: ":8099",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			got, err := HttpAddress(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("HttpAddress() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHttpAddressMissingFile(t *testing.T) {
+	if _, err := HttpAddress(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Fatal("HttpAddress() of a missing file did not fail")
+	}
+}
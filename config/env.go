@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	envPrefix      = "DAIKIN"
+	DefaultPath    = "./config.yaml"
+	ConfigPathEnv  = "DAIKIN_CONFIG"
+	fileEnvSuffix  = "_FILE"
+	fileYAMLSuffix = "_file"
+)
+
+// Path returns the configuration file to load. The --config flag value takes
+// precedence over the DAIKIN_CONFIG environment variable, then the add-on
+// options file when running as a Home Assistant add-on, then ./config.yaml.
+func Path(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(ConfigPathEnv); env != "" {
+		return env
+	}
+	if IsAddon() {
+		return AddonOptionsPath
+	}
+	return DefaultPath
+}
+
+// applyOverrides replaces configuration values from the environment and from
+// secret files. For every field, in order of precedence:
+//
+//  1. the DAIKIN_<PATH> environment variable, e.g. DAIKIN_MQTT_PASSWORD or
+//     DAIKIN_DEVICES_0_SECRET_KEY;
+//  2. the file named by the DAIKIN_<PATH>_FILE environment variable;
+//  3. the file named by the <field>_file key in the YAML, for the fields that
+//     have one (mqtt.password_file, http.token_file and
+//     devices[].secret_key_file);
+//  4. the value in the YAML.
+//
+// Devices are addressed by their position in the list and must exist in the
+// YAML. List values such as operation_modes are comma separated.
+func applyOverrides(config *Config) error {
+	return overrideStruct(reflect.ValueOf(config).Elem(), envPrefix)
+}
+
+func overrideStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	fileFields := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		tag := yamlName(t.Field(i))
+		if name, ok := strings.CutSuffix(tag, fileYAMLSuffix); ok {
+			fileFields[name] = v.Field(i).String()
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := yamlName(field)
+		if tag == "" || strings.HasSuffix(tag, fileYAMLSuffix) {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(tag)
+		value := v.Field(i)
+
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			if err := overrideStruct(value, name); err != nil {
+				return err
+			}
+			continue
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			for j := 0; j < value.Len(); j++ {
+				if err := overrideStruct(value.Index(j), name+"_"+strconv.Itoa(j)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		raw, ok, err := lookup(name)
+		if err != nil {
+			return err
+		}
+		if !ok && fileFields[tag] != "" {
+			raw, err = readSecret(fileFields[tag])
+			if err != nil {
+				return fmt.Errorf("%s%s: %w", tag, fileYAMLSuffix, err)
+			}
+			ok = true
+		}
+		if !ok {
+			continue
+		}
+
+		if err := setValue(value, raw); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// lookup returns the value of the environment variable name, or the content of
+// the file named by name_FILE.
+func lookup(name string) (string, bool, error) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true, nil
+	}
+	if path, ok := os.LookupEnv(name + fileEnvSuffix); ok {
+		value, err := readSecret(path)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", name+fileEnvSuffix, err)
+		}
+		return value, true, nil
+	}
+	return "", false, nil
+}
+
+// readSecret reads a secret file, ignoring the trailing newline editors and
+// `echo` usually add.
+func readSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint8:
+		u, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
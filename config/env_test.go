@@ -0,0 +1,246 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testConfig = `
+mqtt:
+  host: localhost
+  port: "1883"
+  password: yaml-password
+  {{password_file}}
+polling:
+  interval: 5s
+devices:
+  - name: Sala
+    unique_id: sala
+    address: http://192.168.0.15:15914
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+    {{secret_key_file}}
+`
+
+// otherKey is a valid secret key different from the one in testConfig.
+const otherKey = "ZmVkY2JhOTg3NjU0MzIxMA=="
+
+func TestApplyOverrides(t *testing.T) {
+	tests := []struct {
+		name string
+		// yaml replaces the {{...}} placeholders of testConfig.
+		yaml map[string]string
+		env  map[string]string
+		// files are written to the test directory, referenced as {{dir}}.
+		files map[string]string
+		check func(t *testing.T, c *Config)
+	}{
+		{
+			name: "yaml value",
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Mqtt.Password, "yaml-password")
+			},
+		},
+		{
+			name:  "yaml file key beats the yaml value",
+			yaml:  map[string]string{"password_file": "password_file: {{dir}}/yaml"},
+			files: map[string]string{"yaml": "from-yaml-file\n"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Mqtt.Password, "from-yaml-file")
+			},
+		},
+		{
+			name:  "file env beats the yaml file key",
+			yaml:  map[string]string{"password_file": "password_file: {{dir}}/yaml"},
+			env:   map[string]string{"DAIKIN_MQTT_PASSWORD_FILE": "{{dir}}/env"},
+			files: map[string]string{"yaml": "from-yaml-file", "env": "from-env-file\r\n"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Mqtt.Password, "from-env-file")
+			},
+		},
+		{
+			name: "env beats the file env and the yaml file key",
+			yaml: map[string]string{"password_file": "password_file: {{dir}}/yaml"},
+			env: map[string]string{
+				"DAIKIN_MQTT_PASSWORD":      "from-env",
+				"DAIKIN_MQTT_PASSWORD_FILE": "{{dir}}/env",
+			},
+			files: map[string]string{"yaml": "from-yaml-file", "env": "from-env-file"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Mqtt.Password, "from-env")
+			},
+		},
+		{
+			name:  "device secret key from the yaml file key",
+			yaml:  map[string]string{"secret_key_file": "secret_key_file: {{dir}}/key"},
+			files: map[string]string{"key": otherKey + "\n"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Devices[0].SecretKey, otherKey)
+			},
+		},
+		{
+			name:  "device secret key from the file env",
+			env:   map[string]string{"DAIKIN_DEVICES_0_SECRET_KEY_FILE": "{{dir}}/key"},
+			files: map[string]string{"key": otherKey},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Devices[0].SecretKey, otherKey)
+			},
+		},
+		{
+			name: "device fields from env",
+			env: map[string]string{
+				"DAIKIN_DEVICES_0_SECRET_KEY":      otherKey,
+				"DAIKIN_DEVICES_0_ADDRESS":         "http://192.168.0.20:15914",
+				"DAIKIN_DEVICES_0_POLL_INTERVAL":   "1m",
+				"DAIKIN_DEVICES_0_OPERATION_MODES": "cool, heat,,off",
+				// devices must exist in the yaml
+				"DAIKIN_DEVICES_1_NAME": "Quarto",
+			},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, len(c.Devices), 1)
+				d := c.Devices[0]
+				assertEqual(t, d.SecretKey, otherKey)
+				assertEqual(t, d.Address, "http://192.168.0.20:15914")
+				assertEqual(t, d.PollInterval, time.Minute)
+				assertEqual(t, d.OperationModes, []string{"cool", "heat", "off"})
+			},
+		},
+		{
+			name: "scalar types",
+			env: map[string]string{
+				"DAIKIN_POLLING_INTERVAL":       "2s",
+				"DAIKIN_POLLING_JITTER":         "0.5",
+				"DAIKIN_POLLING_MAX_CONCURRENT": "8",
+				"DAIKIN_MQTT_STATE_QOS":         "1",
+				"DAIKIN_MQTT_RETAIN_STATE":      "true",
+				"DAIKIN_MQTT_CLEAN_SESSION":     "false",
+			},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Polling.Interval, 2*time.Second)
+				if c.Polling.Jitter == nil || *c.Polling.Jitter != 0.5 {
+					t.Errorf("Jitter = %v, want a pointer to 0.5", c.Polling.Jitter)
+				}
+				assertEqual(t, c.Polling.MaxConcurrent, 8)
+				assertEqual(t, c.Mqtt.StateQoS, byte(1))
+				assertEqual(t, c.Mqtt.RetainState, true)
+				if c.Mqtt.CleanSession == nil || *c.Mqtt.CleanSession {
+					t.Errorf("CleanSession = %v, want a pointer to false", c.Mqtt.CleanSession)
+				}
+			},
+		},
+		{
+			name: "http listens on the default address",
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Http.Address(), DefaultHttpListen)
+			},
+		},
+		{
+			name: "http listen from env",
+			env:  map[string]string{"DAIKIN_HTTP_LISTEN": "127.0.0.1:9090"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Http.Address(), "127.0.0.1:9090")
+			},
+		},
+		{
+			name: "http disabled from env",
+			env:  map[string]string{"DAIKIN_HTTP_DISABLED": "true", "DAIKIN_HTTP_LISTEN": ":9090"},
+			check: func(t *testing.T, c *Config) {
+				assertEqual(t, c.Http.Address(), "")
+			},
+		},
+		{
+			name: "unset pointer stays nil",
+			check: func(t *testing.T, c *Config) {
+				if c.Mqtt.CleanSession != nil {
+					t.Errorf("CleanSession = %v, want nil", *c.Mqtt.CleanSession)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			expand := func(s string) string { return strings.ReplaceAll(s, "{{dir}}", dir) }
+			for name, content := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, expand(value))
+			}
+			c, err := NewConfig(writeTestConfig(t, dir, tt.yaml))
+			if err != nil {
+				t.Fatalf("NewConfig() error = %v", err)
+			}
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    map[string]string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "invalid duration",
+			env:     map[string]string{"DAIKIN_POLLING_INTERVAL": "often"},
+			wantErr: "DAIKIN_POLLING_INTERVAL",
+		},
+		{
+			name:    "invalid bool",
+			env:     map[string]string{"DAIKIN_MQTT_CLEAN_SESSION": "maybe"},
+			wantErr: "DAIKIN_MQTT_CLEAN_SESSION",
+		},
+		{
+			name:    "missing file env",
+			env:     map[string]string{"DAIKIN_MQTT_PASSWORD_FILE": "{{dir}}/missing"},
+			wantErr: "DAIKIN_MQTT_PASSWORD_FILE",
+		},
+		{
+			name:    "missing yaml file key",
+			yaml:    map[string]string{"password_file": "password_file: {{dir}}/missing"},
+			wantErr: "password_file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, value := range tt.env {
+				t.Setenv(name, strings.ReplaceAll(value, "{{dir}}", dir))
+			}
+			_, err := NewConfig(writeTestConfig(t, dir, tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewConfig() error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// writeTestConfig writes testConfig with its placeholders replaced to dir.
+func writeTestConfig(t *testing.T, dir string, placeholders map[string]string) string {
+	t.Helper()
+	data := testConfig
+	for _, name := range []string{"password_file", "secret_key_file"} {
+		data = strings.ReplaceAll(data, "{{"+name+"}}", placeholders[name])
+	}
+	data = strings.ReplaceAll(data, "{{dir}}", dir)
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func assertEqual[T any](t *testing.T, got T, want T) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// StateFileName is the default name of the state file, kept next to the config.
+const StateFileName = "state.json"
+
+// State is what the bridge learns at runtime and keeps across restarts.
+type State struct {
+	// Devices is keyed by the lower cased unique id.
+	Devices map[string]DeviceState `json:"devices"`
+}
+
+// DeviceState is the address an AC was found at after it stopped answering at
+// the configured one.
+type DeviceState struct {
+	// ConfiguredAddress is the address in the config when the AC was found, so
+	// editing the config discards the address found.
+	ConfiguredAddress string    `json:"configured_address"`
+	Address           string    `json:"address"`
+	FoundAt           time.Time `json:"found_at"`
+}
+
+// StatePath returns the state file used with the config at configPath.
+func StatePath(cfg *Config, configPath string) string {
+	if cfg.Rediscovery.StatePath != "" {
+		return cfg.Rediscovery.StatePath
+	}
+	return filepath.Join(filepath.Dir(configPath), StateFileName)
+}
+
+// LoadState reads the state file at path. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	state := &State{Devices: make(map[string]DeviceState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("decoding state file %q: %w", path, err)
+	}
+	if state.Devices == nil {
+		state.Devices = make(map[string]DeviceState)
+	}
+	return state, nil
+}
+
+// Save writes the state to path, replacing the previous file atomically.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("writing state file: %w", err)
+	}
+	return nil
+}
+
+// Address returns the address the device was last found at, or its configured
+// address when it was not found elsewhere since the config last changed.
+func (s *State) Address(d Devices) string {
+	found, ok := s.Devices[strings.ToLower(d.UniqueId)]
+	if !ok || found.ConfiguredAddress != d.Address {
+		return d.Address
+	}
+	return found.Address
+}
+
+// SetAddress records that the device was found at address.
+func (s *State) SetAddress(d Devices, address string) {
+	key := strings.ToLower(d.UniqueId)
+	if address == d.Address {
+		delete(s.Devices, key)
+		return
+	}
+	s.Devices[key] = DeviceState{
+		ConfiguredAddress: d.Address,
+		Address:           address,
+		FoundAt:           time.Now(),
+	}
+}
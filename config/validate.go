@@ -0,0 +1,261 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+	"github.com/billbatista/ha-daikin-smart-ac-br/locale"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Problem is a single issue found in the configuration.
+type Problem struct {
+	// Line is the line of the offending value in the YAML file, 0 if unknown.
+	Line    int
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	var b strings.Builder
+	if p.Line > 0 {
+		fmt.Fprintf(&b, "line %d: ", p.Line)
+	}
+	if p.Path != "" {
+		fmt.Fprintf(&b, "%s: ", p.Path)
+	}
+	b.WriteString(p.Message)
+	return b.String()
+}
+
+// ValidationError holds every problem found in the configuration.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		lines = append(lines, p.String())
+	}
+	return "invalid config:\n  " + strings.Join(lines, "\n  ")
+}
+
+// decode unmarshals data into config, returning the document node used to find
+// the line of each value. Unknown fields and values of the wrong type are
+// returned as problems, the rest of the document is still decoded so Validate
+// can report the other problems along with them.
+func decode(data []byte, config *Config) (*yaml.Node, []Problem, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, err
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	err := decoder.Decode(config)
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, err
+		}
+		return &root, nil, nil
+	}
+
+	problems := make([]Problem, 0, len(typeErr.Errors))
+	for _, msg := range typeErr.Errors {
+		var line int
+		if _, scanErr := fmt.Sscanf(msg, "line %d:", &line); scanErr == nil {
+			_, msg, _ = strings.Cut(msg, ": ")
+		}
+		problems = append(problems, Problem{Line: line, Message: msg})
+	}
+	// decode again without the unknown fields check, keeping what could be
+	// decoded of the values of the wrong type
+	*config = Config{}
+	if err := yaml.Unmarshal(data, config); err != nil && !errors.As(err, &typeErr) {
+		return nil, nil, err
+	}
+	return &root, problems, nil
+}
+
+// Validate checks the configuration for missing or malformed values, returning
+// a *ValidationError listing all of them. root is the document node returned by
+// the YAML parser and may be nil, in which case line numbers are not reported.
+func (c *Config) Validate(root *yaml.Node) error {
+	return c.validate(root, nil)
+}
+
+// validate is Validate reporting the given problems, found while decoding,
+// before the others.
+func (c *Config) validate(root *yaml.Node, problems []Problem) error {
+	v := validator{root: root, problems: problems}
+
+	if c.Mqtt.Host == "" {
+		v.add("required", "mqtt", "host")
+	}
+	if port, err := strconv.Atoi(c.Mqtt.Port); err != nil || port < 1 || port > 65535 {
+		v.add(fmt.Sprintf("invalid port %q", c.Mqtt.Port), "mqtt", "port")
+	}
+	if !slices.Contains([]string{"", "tcp", "ssl", "ws", "wss"}, c.Mqtt.Scheme) {
+		v.add(fmt.Sprintf("unsupported scheme %q, must be one of tcp, ssl, ws, wss", c.Mqtt.Scheme), "mqtt", "scheme")
+	}
+	if c.Mqtt.StateQoS > 2 {
+		v.add("must be 0, 1 or 2", "mqtt", "state_qos")
+	}
+	if c.Mqtt.CommandQoS > 2 {
+		v.add("must be 0, 1 or 2", "mqtt", "command_qos")
+	}
+	if (c.Mqtt.ClientCert == "") != (c.Mqtt.ClientKey == "") {
+		v.add("client_cert and client_key must be set together", "mqtt")
+	}
+
+	if _, err := locale.Parse(c.Locale); err != nil {
+		v.add("must be pt-BR, en or es", "locale")
+	}
+
+	if c.Http.Listen != "" {
+		if _, port, err := net.SplitHostPort(c.Http.Listen); err != nil || port == "" {
+			v.add(fmt.Sprintf("invalid address %q, expected something like :8080", c.Http.Listen), "http", "listen")
+		}
+	}
+
+	if c.Polling.Jitter != nil && (*c.Polling.Jitter < 0 || *c.Polling.Jitter >= 1) {
+		v.add("must be between 0 and 1", "polling", "jitter")
+	}
+	if c.Polling.MaxConcurrent < 0 {
+		v.add("must not be negative", "polling", "max_concurrent")
+	}
+
+	for i, subnet := range c.Rediscovery.Subnets {
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil || !prefix.Addr().Is4() || prefix.Bits() < 16 {
+			v.add(fmt.Sprintf("invalid subnet %q, expected an IPv4 subnet of at most /16 like 192.168.0.0/24", subnet), "rediscovery", "subnets", strconv.Itoa(i))
+		}
+	}
+
+	uniqueIds := make(map[string]int)
+	for i, d := range c.Devices {
+		index := strconv.Itoa(i)
+
+		if d.UniqueId == "" {
+			v.add("required", "devices", index, "unique_id")
+		} else if first, ok := uniqueIds[strings.ToLower(d.UniqueId)]; ok {
+			v.add(fmt.Sprintf("duplicated, already used by devices[%d]", first), "devices", index, "unique_id")
+		} else {
+			uniqueIds[strings.ToLower(d.UniqueId)] = i
+		}
+
+		if d.Address == "" {
+			// the bridge looks for the AC by its MAC or secret key otherwise
+			if d.Mac == "" && c.Rediscovery.Disabled {
+				v.add("required when mac is not set and rediscovery is disabled", "devices", index, "address")
+			}
+		} else if u, err := url.Parse(d.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(fmt.Sprintf("invalid address %q, expected something like http://192.168.0.15:15914", d.Address), "devices", index, "address")
+		}
+
+		if d.Mac != "" {
+			if _, err := net.ParseMAC(d.Mac); err != nil {
+				v.add(fmt.Sprintf("invalid mac %q, expected something like 00:11:22:33:44:55", d.Mac), "devices", index, "mac")
+			}
+		}
+
+		if d.SecretKey == "" {
+			v.add("required", "devices", index, "secret_key")
+		} else if key, err := base64.StdEncoding.DecodeString(d.SecretKey); err != nil {
+			v.add("not valid base64", "devices", index, "secret_key")
+		} else if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+			v.add(fmt.Sprintf("decodes to %d bytes, expected 16, 24 or 32", len(key)), "devices", index, "secret_key")
+		}
+
+		for j, mode := range d.OperationModes {
+			if !slices.Contains(daikin.DefaultOperationModes, mode) {
+				v.add(fmt.Sprintf("unknown mode %q, must be one of %s", mode, strings.Join(daikin.DefaultOperationModes, ", ")), "devices", index, "operation_modes", strconv.Itoa(j))
+			}
+		}
+		for j, mode := range d.FanModes {
+			if !slices.Contains(daikin.DefaultFanModes, mode) {
+				v.add(fmt.Sprintf("unknown fan mode %q, must be one of %s", mode, strings.Join(daikin.DefaultFanModes, ", ")), "devices", index, "fan_modes", strconv.Itoa(j))
+			}
+		}
+
+		if d.PollInterval < 0 {
+			v.add("must not be negative", "devices", index, "poll_interval")
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+type validator struct {
+	root     *yaml.Node
+	problems []Problem
+}
+
+func (v *validator) add(message string, path ...string) {
+	v.problems = append(v.problems, Problem{
+		Line:    line(v.root, path...),
+		Path:    formatPath(path),
+		Message: message,
+	})
+}
+
+// line returns the line of the node at path, or of its closest existing parent.
+func line(node *yaml.Node, path ...string) int {
+	if node == nil {
+		return 0
+	}
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, key := range path {
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return node.Line
+}
+
+// formatPath renders a path like devices[0].secret_key.
+func formatPath(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		if _, err := strconv.Atoi(p); err == nil {
+			fmt.Fprintf(&b, "[%s]", p)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
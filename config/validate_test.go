@@ -0,0 +1,151 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			name: "valid",
+			yaml: `
+mqtt:
+  host: localhost
+  port: "1883"
+devices:
+  - unique_id: sala
+    address: http://192.168.0.15:15914
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+`,
+		},
+		{
+			name: "unknown field does not hide the other problems",
+			yaml: `
+bogus: true
+mqtt:
+  port: "99999"
+devices:
+  - unique_id: sala
+    address: http://192.168.0.15:15914
+    secret_key: not base64
+    operation_modes:
+      - cool
+      - turbo
+  - unique_id: Sala
+    address: 192.168.0.16
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+`,
+			want: []string{
+				"line 2: field bogus not found in type config.Config",
+				"line 4: mqtt.host: required",
+				`line 4: mqtt.port: invalid port "99999"`,
+				"line 8: devices[0].secret_key: not valid base64",
+				`line 11: devices[0].operation_modes[1]: unknown mode "turbo", must be one of auto, off, cool, heat, dry, fan_only`,
+				"line 12: devices[1].unique_id: duplicated, already used by devices[0]",
+				`line 13: devices[1].address: invalid address "192.168.0.16", expected something like http://192.168.0.15:15914`,
+			},
+		},
+		{
+			name: "wrong type",
+			yaml: `
+mqtt:
+  host: localhost
+  port: "1883"
+  state_qos: high
+polling:
+  jitter: 2
+devices: []
+`,
+			want: []string{
+				"line 5: cannot unmarshal !!str `high` into uint8",
+				"line 7: polling.jitter: must be between 0 and 1",
+			},
+		},
+		{
+			name: "address is only required without a way to find the ac",
+			yaml: `
+mqtt:
+  host: localhost
+  port: "1883"
+rediscovery:
+  disabled: true
+devices:
+  - unique_id: sala
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+  - unique_id: quarto
+    mac: 00:11:22:33:44:55
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+  - unique_id: cozinha
+    mac: not a mac
+    secret_key: MDEyMzQ1Njc4OWFiY2RlZg==
+`,
+			want: []string{
+				"line 8: devices[0].address: required when mac is not set and rediscovery is disabled",
+				`line 14: devices[2].mac: invalid mac "not a mac", expected something like 00:11:22:33:44:55`,
+			},
+		},
+		{
+			name: "tls client certificate",
+			yaml: `
+mqtt:
+  host: localhost
+  port: "8883"
+  scheme: mqtts
+  client_cert: /certs/client.pem
+devices: []
+`,
+			want: []string{
+				`line 5: mqtt.scheme: unsupported scheme "mqtts", must be one of tcp, ssl, ws, wss`,
+				"line 3: mqtt: client_cert and client_key must be set together",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewConfig(path)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("NewConfig() error = %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("NewConfig() error = %v, want a *ValidationError", err)
+			}
+			var got []string
+			for _, p := range validationErr.Problems {
+				got = append(got, p.String())
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("problems:\n  %s\nwant:\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestNewConfigSyntaxError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("mqtt: [\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewConfig(path)
+	var validationErr *ValidationError
+	if err == nil || errors.As(err, &validationErr) {
+		t.Fatalf("NewConfig() error = %v, want a syntax error", err)
+	}
+}
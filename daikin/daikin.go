@@ -5,9 +5,13 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
+	"sync/atomic"
 	"time"
 
 	"github.com/valyala/fasthttp"
@@ -15,90 +19,167 @@ import (
 
 // Client creates a Daikin client.
 type Client struct {
-	target    *url.URL
+	target    atomic.Pointer[url.URL]
 	secretKey []byte
+	hook      RequestHook
+}
+
+// RequestHook is called after every request made to the AC with the path, how
+// long it took and the transport error, if any.
+type RequestHook func(method string, path string, duration time.Duration, err error)
+
+// SetRequestHook sets the hook called after every request, e.g. to measure the
+// latency. It must be called before the client is used.
+func (c *Client) SetRequestHook(hook RequestHook) {
+	c.hook = hook
 }
 
 // NewClient creates a *Client.
 func NewClient(target *url.URL, secretKey []byte) *Client {
-	return &Client{
-		target:    target,
-		secretKey: secretKey,
-	}
+	c := &Client{secretKey: secretKey}
+	c.target.Store(target)
+	return c
+}
+
+// Target returns the address of the AC.
+func (c *Client) Target() *url.URL {
+	return c.target.Load()
+}
+
+// SetTarget changes the address of the AC, e.g. after it got a new IP. It is
+// safe to call while requests are in flight.
+func (c *Client) SetTarget(target *url.URL) {
+	c.target.Store(target)
 }
 
 // makes a request to the given path returning the response as a byte slice.
 func (c *Client) makeRequest(ctx context.Context, method string, path string, body []byte) ([]byte, error) {
-	// we have to use a custom http client because the server sends invalid http responses
-	// example below:
-	//  	HTTP/1.1 200 OK
-	//  			Content-Type: application/json
-	c.target.Path = path
-	var (
-		endpoint = c.target.String()
-		req      = fasthttp.AcquireRequest()
-		resp     = fasthttp.AcquireResponse()
-	)
-	defer fasthttp.ReleaseRequest(req)
-	defer fasthttp.ReleaseResponse(resp)
-	req.SetRequestURI(endpoint)
-	req.Header.SetMethod(method)
-	req.SetTimeout(15 * time.Second)
-	if len(body) > 0 {
-		req.SetBody(body)
+	target := *c.target.Load()
+	if target.Host == "" {
+		return nil, fmt.Errorf("%w: the address of the ac is not known yet", ErrUnreachable)
+	}
+	target.Path = path
+	endpoint := target.String()
+	start := time.Now()
+	status, respBody, err := doRequest(ctx, method, endpoint, body)
+	if c.hook != nil {
+		c.hook(method, path, time.Since(start), err)
 	}
-	if err := fasthttp.Do(req, resp); err != nil {
-		return nil, fmt.Errorf("making request to %q: %w", endpoint, err)
+	if err != nil {
+		return nil, err
 	}
-	if resp.StatusCode() != http.StatusOK {
-		return nil, fmt.Errorf("request to %q returned status code %d", endpoint, resp.StatusCode())
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("%w: request to %q returned status code %d", ErrUnexpectedResponse, endpoint, status)
 	}
-	data, err := base64.StdEncoding.DecodeString(string(resp.Body()))
+	data, err := base64.StdEncoding.DecodeString(string(respBody))
 	if err != nil {
-		return nil, fmt.Errorf("decoding body: %w", err)
+		return nil, fmt.Errorf("%w: decoding body: %w", ErrUnexpectedResponse, err)
 	}
 	return data, nil
 }
 
-// decodeData decodes the given data using the given secretKey.
-func decodeData(secretKey []byte, data []byte, path string) ([]byte, error) {
-	if len(data) < 16+2 {
-		return nil, fmt.Errorf("input data is too short to contain a payload")
+// requestTimeout bounds every request made to an AC.
+const requestTimeout = 15 * time.Second
+
+// doRequest sends body to endpoint returning the status code and raw body.
+func doRequest(ctx context.Context, method string, endpoint string, body []byte) (int, []byte, error) {
+	return send(ctx, method, endpoint, body, requestTimeout)
+}
+
+// send is doRequest with the given timeout. The request is bounded by the
+// deadline of ctx too, and send returns as soon as ctx is done, so shutting
+// down never waits for an AC that is not answering.
+func send(ctx context.Context, method string, endpoint string, body []byte, timeout time.Duration) (int, []byte, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, nil, fmt.Errorf("making request to %q: %w", endpoint, err)
 	}
-	var (
-		startPayload = 16
-		hasLength    = false
-	)
-	switch path {
-	case "acstatus":
-		startPayload = 17
-	case "get_scan", "status", "onboard":
-		startPayload = 17
-		hasLength = true
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
-	var (
-		iv         = data[:16]
-		length     = data[16] & 255
-		payload    = data[startPayload : len(data)-2]
-		crc16Bytes = data[len(data)-2:]
-		crc16      = (int(crc16Bytes[1]&255) << 8) | int(crc16Bytes[0]&255)
-		crc16Check = calculateCRC16(data[:len(data)-2]) & 65535
-	)
-	_, _ = length, hasLength // not used for now, we don't know what it means or if is required
-	if crc16 != crc16Check {
-		return nil, fmt.Errorf("invalid crc16")
+
+	type result struct {
+		status int
+		body   []byte
+		err    error
 	}
-	decoded, err := decryptAESCFB(payload, secretKey, iv)
+	done := make(chan result, 1)
+	go func() {
+		// we have to use a custom http client because the server sends invalid http responses
+		// example below:
+		//  	HTTP/1.1 200 OK
+		//  			Content-Type: application/json
+		var (
+			req  = fasthttp.AcquireRequest()
+			resp = fasthttp.AcquireResponse()
+		)
+		defer fasthttp.ReleaseRequest(req)
+		defer fasthttp.ReleaseResponse(resp)
+		req.SetRequestURI(endpoint)
+		req.Header.SetMethod(method)
+		if len(body) > 0 {
+			req.SetBody(body)
+		}
+		if err := fasthttp.DoDeadline(req, resp, deadline); err != nil {
+			done <- result{err: err}
+			return
+		}
+		done <- result{status: resp.StatusCode(), body: append([]byte(nil), resp.Body()...)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return 0, nil, fmt.Errorf("%w: making request to %q: %w", ErrUnreachable, endpoint, r.err)
+		}
+		return r.status, r.body, nil
+	case <-ctx.Done():
+		// the request goroutine finishes on its own by the deadline
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// the AC did not answer in time, like a fasthttp timeout
+			return 0, nil, fmt.Errorf("%w: making request to %q: %w", ErrUnreachable, endpoint, ctx.Err())
+		}
+		return 0, nil, fmt.Errorf("making request to %q: %w", endpoint, ctx.Err())
+	}
+}
+
+// Errors returned by the client, wrapped with more context. They tell apart an
+// AC that is not answering from a wrong address or a wrong secret key.
+var (
+	ErrUnreachable        = errors.New("ac unreachable")
+	ErrUnexpectedResponse = errors.New("unexpected response, check the address")
+	ErrInvalidCRC         = errors.New("invalid crc16")
+	ErrWrongKey           = errors.New("decrypted payload is not json, check the secret key")
+)
+
+// hasHeader reports whether the responses to path carry a header byte after the IV.
+func hasHeader(path string) bool {
+	switch path {
+	case "acstatus", "get_scan", "status", "onboard":
+		return true
+	}
+	return false
+}
+
+// decodeData decodes the given data using the given secretKey.
+func decodeData(secretKey []byte, data []byte, path string) ([]byte, error) {
+	frame, err := DecodeFrame(secretKey, data, hasHeader(path))
 	if err != nil {
-		return nil, fmt.Errorf("decoding payload, check the secret key")
+		return nil, err
+	}
+	if !frame.ValidCRC() {
+		return nil, ErrInvalidCRC
+	}
+	if frame.JSON == nil {
+		return nil, ErrWrongKey
 	}
-	return decoded, nil
+	return frame.Plaintext, nil
 }
 
 // encodeData encodes the given data using the secretKey.
 func encodeData(secretKey []byte, data []byte) ([]byte, error) {
 	var (
-		iv        = make([]byte, 16)
+		iv        = make([]byte, ivSize)
 		inputData = make([]byte, 0, len(data)+2)
 	)
 	if _, err := rand.Read(iv); err != nil {
@@ -106,16 +187,7 @@ func encodeData(secretKey []byte, data []byte) ([]byte, error) {
 	}
 	inputData = append(inputData, data...)
 	inputData = append(inputData, []byte("BZ")...) // not sure why we should encode the BZ here
-	encrypted, err := encryptAESCFB(inputData, secretKey, iv)
-	if err != nil {
-		return nil, fmt.Errorf("encrypt data: %w", err)
-	}
-	output := make([]byte, 0, len(encrypted)+18) // 16 bytes iv + 2 bytes crc16
-	output = append(output, iv...)
-	output = append(output, encrypted...)
-	crc16 := calculateCRC16(output)
-	output = append(output, byte(crc16&255), byte(crc16>>8)&255)
-	return output, nil
+	return EncodeFrame(secretKey, iv, nil, inputData)
 }
 
 type StatusResponse struct {
@@ -137,6 +209,11 @@ func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
 	if err != nil {
 		return nil, err
 	}
+	return c.decodeStatus(data)
+}
+
+// decodeStatus decrypts and parses a /status response.
+func (c *Client) decodeStatus(data []byte) (*StatusResponse, error) {
 	decoded, err := decodeData(c.secretKey, data, "status")
 	if err != nil {
 		return nil, fmt.Errorf("decoding response: %w", err)
@@ -149,8 +226,34 @@ func (c *Client) Status(ctx context.Context) (*StatusResponse, error) {
 }
 
 type State struct {
+	// Port1 is the first indoor unit, the only one of single split ACs.
 	Port1 Port `json:"port1"`
-	Idu   int  `json:"idu"`
+	// Ports holds every indoor unit sent by the AC, port1 included, by name.
+	Ports map[string]Port `json:"-"`
+	Idu   int             `json:"idu"`
+	// Extra holds the top level fields that are not known yet.
+	Extra map[string]json.RawMessage `json:"-"`
+	// Raw is the JSON the state was decoded from.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Clone returns a copy of the state that shares no memory with s.
+func (s *State) Clone() *State {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	clone.Extra = maps.Clone(s.Extra)
+	clone.Port1.Extra = maps.Clone(s.Port1.Extra)
+	if s.Ports != nil {
+		clone.Ports = make(map[string]Port, len(s.Ports))
+		for name, p := range s.Ports {
+			p.Extra = maps.Clone(p.Extra)
+			clone.Ports[name] = p
+		}
+	}
+	clone.Raw = slices.Clone(s.Raw)
+	return &clone
 }
 
 // State query for the device state.
@@ -170,8 +273,11 @@ func (c *Client) State(ctx context.Context) (*State, error) {
 	return &resp, nil
 }
 
+// DesiredState holds the fields to change on each port. Use NewDesiredState to
+// target a port other than port1.
 type DesiredState struct {
-	Port1 PortState `json:"port1"`
+	Port1 PortState
+	Ports map[string]PortState
 }
 
 // SetState sets the desired state on the device.
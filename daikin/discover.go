@@ -0,0 +1,260 @@
+package daikin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the port the AC serves its local API on.
+const DefaultPort = 15914
+
+// maxScanBits is the largest IPv4 subnet Discover scans, a /16.
+const maxScanBits = 16
+
+// DiscoverOptions controls Discover. Zero values use the defaults.
+type DiscoverOptions struct {
+	// Subnets are scanned host by host. Defaults to the /24 around every IPv4
+	// address of the local interfaces.
+	Subnets []netip.Prefix
+	// Port defaults to DefaultPort.
+	Port int
+	// Keys are tried on every host found, by name, to tell which configured
+	// device it is.
+	Keys map[string][]byte
+	// Timeout bounds the request made to each host. Defaults to a second.
+	Timeout time.Duration
+	// Concurrency caps the hosts probed at the same time. Defaults to 64.
+	Concurrency int
+}
+
+// DiscoveredHost is a host answering /status like an AC does.
+type DiscoveredHost struct {
+	Address *url.URL
+	// Key is the name of the key that decrypts the host responses, empty when
+	// none of the given keys does.
+	Key    string
+	Status *StatusResponse
+}
+
+// Discover scans the subnets for hosts answering /status and matches them to
+// the given keys. The firmware does not announce itself over broadcast or
+// mDNS, as far as we have seen, so scanning is the only way to find it. The
+// hosts are returned sorted by address.
+func Discover(ctx context.Context, opts DiscoverOptions) ([]DiscoveredHost, error) {
+	if opts.Port == 0 {
+		opts.Port = DefaultPort
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 64
+	}
+	if len(opts.Subnets) == 0 {
+		subnets, err := LocalSubnets()
+		if err != nil {
+			return nil, err
+		}
+		opts.Subnets = subnets
+	}
+	if len(opts.Subnets) == 0 {
+		return nil, errors.New("no subnet to scan")
+	}
+	for _, subnet := range opts.Subnets {
+		if !subnet.Addr().Is4() || subnet.Bits() < maxScanBits {
+			return nil, fmt.Errorf("subnet %s is not an IPv4 subnet of at most /%d", subnet, maxScanBits)
+		}
+	}
+
+	var (
+		mu    sync.Mutex
+		found []DiscoveredHost
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, opts.Concurrency)
+	)
+scan:
+	for _, subnet := range opts.Subnets {
+		for addr := range hosts(subnet) {
+			select {
+			case <-ctx.Done():
+				break scan
+			case slots <- struct{}{}:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-slots }()
+				host, ok := probeHost(ctx, addr, opts)
+				if ok {
+					mu.Lock()
+					found = append(found, host)
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	found = slices.CompactFunc(sortHosts(found), func(a, b DiscoveredHost) bool {
+		return a.Address.String() == b.Address.String()
+	})
+	return found, nil
+}
+
+// Rediscover scans the subnets of opts for the host decrypting with the key of
+// the client, on the port of its current address unless opts sets one, and
+// switches the client to it. It returns nil when the AC was not found. The
+// keys of opts are ignored.
+func (c *Client) Rediscover(ctx context.Context, opts DiscoverOptions) (*url.URL, error) {
+	const self = "self"
+	current := c.Target()
+	if opts.Port == 0 {
+		if port, err := strconv.Atoi(current.Port()); err == nil {
+			opts.Port = port
+		}
+	}
+	opts.Keys = map[string][]byte{self: c.secretKey}
+	hosts, err := Discover(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, host := range hosts {
+		if host.Key != self {
+			continue
+		}
+		target := *current
+		target.Host = host.Address.Host
+		c.SetTarget(&target)
+		return &target, nil
+	}
+	return nil, nil
+}
+
+// LookupMAC returns the IPv4 address the kernel ARP table has for mac. It only
+// works on Linux, and only for hosts talked to recently, which scanning their
+// subnet ensures.
+func LookupMAC(mac net.HardwareAddr) (netip.Addr, bool) {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	// IP address  HW type  Flags  HW address  Mask  Device
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		hw, err := net.ParseMAC(fields[3])
+		if err != nil || !bytes.Equal(hw, mac) {
+			continue
+		}
+		if addr, err := netip.ParseAddr(fields[0]); err == nil {
+			return addr, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+// probeHost reports whether the host at addr answers /status with an encrypted
+// payload, trying every key on it.
+func probeHost(ctx context.Context, addr netip.Addr, opts DiscoverOptions) (DiscoveredHost, bool) {
+	target := &url.URL{Scheme: "http", Host: netip.AddrPortFrom(addr, uint16(opts.Port)).String()}
+	status, body, err := send(ctx, http.MethodGet, target.JoinPath("status").String(), nil, opts.Timeout)
+	if err != nil || status != http.StatusOK {
+		return DiscoveredHost{}, false
+	}
+	data, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil || len(data) < ivSize+crcSize {
+		return DiscoveredHost{}, false
+	}
+
+	host := DiscoveredHost{Address: target}
+	names := make([]string, 0, len(opts.Keys))
+	for name := range opts.Keys {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		client := NewClient(target, opts.Keys[name])
+		if resp, err := client.decodeStatus(data); err == nil {
+			host.Key, host.Status = name, resp
+			break
+		}
+	}
+	return host, true
+}
+
+// hosts yields the host addresses of subnet, skipping the network and
+// broadcast addresses when the subnet has them.
+func hosts(subnet netip.Prefix) func(yield func(netip.Addr) bool) {
+	return func(yield func(netip.Addr) bool) {
+		subnet = subnet.Masked()
+		first := subnet.Addr()
+		if subnet.Bits() < 31 {
+			first = first.Next()
+		}
+		for addr := first; addr.IsValid() && subnet.Contains(addr); addr = addr.Next() {
+			if subnet.Bits() < 31 && !subnet.Contains(addr.Next()) {
+				return
+			}
+			if !yield(addr) {
+				return
+			}
+		}
+	}
+}
+
+// LocalSubnets returns the /24 around every IPv4 address of the local
+// interfaces, or the interface subnet itself when it is smaller.
+func LocalSubnets() ([]netip.Prefix, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing interface addresses: %w", err)
+	}
+	var subnets []netip.Prefix
+	for _, a := range addrs {
+		ipNet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(ipNet.IP)
+		if !ok {
+			continue
+		}
+		addr = addr.Unmap()
+		if !addr.Is4() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+			continue
+		}
+		bits, _ := ipNet.Mask.Size()
+		subnet := netip.PrefixFrom(addr, max(bits, 24)).Masked()
+		if !slices.Contains(subnets, subnet) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets, nil
+}
+
+func sortHosts(found []DiscoveredHost) []DiscoveredHost {
+	slices.SortFunc(found, func(a, b DiscoveredHost) int {
+		x, _ := netip.ParseAddrPort(a.Address.Host)
+		y, _ := netip.ParseAddrPort(b.Address.Host)
+		return x.Compare(y)
+	})
+	return found
+}
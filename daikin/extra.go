@@ -0,0 +1,91 @@
+package daikin
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var unmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+
+// unknownFields adds to extra the members of the JSON object data without a
+// matching json tag in t, recursing into struct fields. Nested keys are joined
+// with a dot, e.g. "sensors.humidity".
+func unknownFields(data []byte, t reflect.Type, prefix string, extra map[string]json.RawMessage) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return
+	}
+	known := make(map[string]reflect.Type, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		known[name] = field.Type
+	}
+	for key, value := range object {
+		fieldType, ok := known[key]
+		if !ok {
+			extra[prefix+key] = value
+			continue
+		}
+		// types with their own decoding, like Port, collect their unknown fields
+		if fieldType.Kind() == reflect.Struct && !reflect.PointerTo(fieldType).Implements(unmarshalerType) {
+			unknownFields(value, fieldType, prefix+key+".", extra)
+		}
+	}
+}
+
+func (p *Port) UnmarshalJSON(data []byte) error {
+	type plain Port
+	if err := json.Unmarshal(data, (*plain)(p)); err != nil {
+		return err
+	}
+	p.Extra = nil
+	extra := make(map[string]json.RawMessage)
+	unknownFields(data, reflect.TypeOf(plain{}), "", extra)
+	if len(extra) > 0 {
+		p.Extra = extra
+	}
+	return nil
+}
+
+func (s *State) UnmarshalJSON(data []byte) error {
+	type plain State
+	if err := json.Unmarshal(data, (*plain)(s)); err != nil {
+		return err
+	}
+	s.Raw = append(json.RawMessage(nil), data...)
+	s.Extra = nil
+	extra := make(map[string]json.RawMessage)
+	unknownFields(data, reflect.TypeOf(plain{}), "", extra)
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+
+	// port1 is decoded into Port1 and the other ports generically, port1 being
+	// listed in Ports only when the AC sent it
+	s.Ports = make(map[string]Port)
+	for key, value := range extra {
+		if !IsPortName(key) {
+			continue
+		}
+		var p Port
+		if err := json.Unmarshal(value, &p); err != nil {
+			return fmt.Errorf("decoding %s: %w", key, err)
+		}
+		s.Ports[key] = p
+		delete(extra, key)
+	}
+	if _, ok := object[DefaultPortName]; ok {
+		s.Ports[DefaultPortName] = s.Port1
+	}
+	if len(extra) > 0 {
+		s.Extra = extra
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package daikin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	ivSize  = 16
+	crcSize = 2
+)
+
+// Frame is a request or response body exchanged with the AC, once base64
+// decoded. Its layout is:
+//
+//	16 bytes IV | [1 header byte] | AES-CFB encrypted payload | 2 bytes CRC16
+//
+// The header byte is only present in responses. It is believed to be a length
+// but its meaning is unknown. The payload is JSON, which in requests is
+// followed by the "BZ" bytes.
+type Frame struct {
+	IV []byte `json:"iv"`
+	// Header is the byte between the IV and the payload, nil when absent.
+	Header *byte `json:"header,omitempty"`
+	// Plaintext is the decrypted payload.
+	Plaintext []byte `json:"plaintext"`
+	// JSON is the leading JSON object of the plaintext, nil when there is none,
+	// usually because the secret key is wrong.
+	JSON json.RawMessage `json:"json,omitempty"`
+	// Trailing are the bytes following the JSON object in the plaintext.
+	Trailing []byte `json:"trailing,omitempty"`
+	// CRC is the checksum sent in the frame and ExpectedCRC the one computed
+	// from its content.
+	CRC         uint16 `json:"crc"`
+	ExpectedCRC uint16 `json:"expected_crc"`
+}
+
+// ValidCRC reports whether the checksum of the frame matches its content.
+func (f *Frame) ValidCRC() bool {
+	return f.CRC == f.ExpectedCRC
+}
+
+// DecodeFrame decrypts a base64 decoded body. hasHeader tells whether a header
+// byte follows the IV, as in the responses to /acstatus and /status. The CRC is
+// not enforced so broken captures can still be inspected, use ValidCRC.
+func DecodeFrame(secretKey []byte, data []byte, hasHeader bool) (*Frame, error) {
+	start := ivSize
+	if hasHeader {
+		start++
+	}
+	if len(data) < start+crcSize {
+		return nil, fmt.Errorf("%w: input data is too short to contain a payload", ErrUnexpectedResponse)
+	}
+
+	crcBytes := data[len(data)-crcSize:]
+	frame := &Frame{
+		IV:          data[:ivSize],
+		CRC:         uint16(crcBytes[1])<<8 | uint16(crcBytes[0]),
+		ExpectedCRC: uint16(calculateCRC16(data[:len(data)-crcSize]) & 65535),
+	}
+	if hasHeader {
+		header := data[ivSize]
+		frame.Header = &header
+	}
+
+	plaintext, err := decryptAESCFB(data[start:len(data)-crcSize], secretKey, frame.IV)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding payload: %w", ErrWrongKey, err)
+	}
+	frame.Plaintext = plaintext
+
+	// garbage decrypted with a wrong key often starts with a digit, which would
+	// decode as a number, so only an object is taken as the payload
+	if trimmed := bytes.TrimLeft(plaintext, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(plaintext))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err == nil {
+			frame.JSON = value
+			frame.Trailing = plaintext[decoder.InputOffset():]
+		}
+	}
+
+	return frame, nil
+}
+
+// EncodeFrame encrypts plaintext with the given IV and appends the CRC16. The
+// header byte is written after the IV when not nil.
+func EncodeFrame(secretKey []byte, iv []byte, header *byte, plaintext []byte) ([]byte, error) {
+	encrypted, err := encryptAESCFB(plaintext, secretKey, iv)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt data: %w", err)
+	}
+	output := make([]byte, 0, len(iv)+1+len(encrypted)+crcSize)
+	output = append(output, iv...)
+	if header != nil {
+		output = append(output, *header)
+	}
+	output = append(output, encrypted...)
+	crc16 := calculateCRC16(output)
+	output = append(output, byte(crc16&255), byte(crc16>>8)&255)
+	return output, nil
+}
@@ -0,0 +1,130 @@
+package daikin
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	iv := bytes.Repeat([]byte{0x42}, ivSize)
+	header := byte(0x2a)
+	tests := []struct {
+		name         string
+		header       *byte
+		plaintext    string
+		wantJSON     string
+		wantTrailing string
+	}{
+		{name: "request", plaintext: `{"port1":{"power":1}}BZ`, wantJSON: `{"port1":{"power":1}}`, wantTrailing: "BZ"},
+		{name: "response with header", header: &header, plaintext: `{"port1":{"power":0},"idu":1}`, wantJSON: `{"port1":{"power":0},"idu":1}`},
+		{name: "empty object", plaintext: `{}`, wantJSON: `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := EncodeFrame(testKey, iv, tt.header, []byte(tt.plaintext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, err := DecodeFrame(testKey, data, tt.header != nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !frame.ValidCRC() {
+				t.Errorf("crc %04x, expected %04x", frame.CRC, frame.ExpectedCRC)
+			}
+			if !bytes.Equal(frame.IV, iv) {
+				t.Errorf("IV = %x, want %x", frame.IV, iv)
+			}
+			if (frame.Header == nil) != (tt.header == nil) || (tt.header != nil && *frame.Header != *tt.header) {
+				t.Errorf("Header = %v, want %v", frame.Header, tt.header)
+			}
+			if string(frame.Plaintext) != tt.plaintext {
+				t.Errorf("Plaintext = %q, want %q", frame.Plaintext, tt.plaintext)
+			}
+			if string(frame.JSON) != tt.wantJSON {
+				t.Errorf("JSON = %s, want %s", frame.JSON, tt.wantJSON)
+			}
+			if string(frame.Trailing) != tt.wantTrailing {
+				t.Errorf("Trailing = %q, want %q", frame.Trailing, tt.wantTrailing)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameBadCRC(t *testing.T) {
+	data, err := EncodeFrame(testKey, make([]byte, ivSize), nil, []byte(`{"power":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[ivSize] ^= 0xff
+	frame, err := DecodeFrame(testKey, data, false)
+	if err != nil {
+		t.Fatalf("DecodeFrame() error = %v, the CRC is not enforced", err)
+	}
+	if frame.ValidCRC() {
+		t.Fatal("ValidCRC() = true for a corrupted frame")
+	}
+	if _, err := decodeData(testKey, data, "acstatus_set"); !errors.Is(err, ErrInvalidCRC) {
+		t.Fatalf("decodeData() error = %v, want ErrInvalidCRC", err)
+	}
+}
+
+func TestDecodeFrameWrongKey(t *testing.T) {
+	iv := make([]byte, ivSize)
+	data, err := EncodeFrame(testKey, iv, nil, []byte(`{"port1":{"power":1,"mode":3}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey := []byte("fedcba9876543210")
+	frame, err := DecodeFrame(wrongKey, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.JSON != nil {
+		t.Fatalf("JSON = %q with the wrong key", frame.JSON)
+	}
+	if _, err := decodeData(wrongKey, data, "acstatus_set"); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("decodeData() error = %v, want ErrWrongKey", err)
+	}
+}
+
+func TestDecodeFrameWithoutHeaderFlag(t *testing.T) {
+	// a response decoded as a request shifts the payload by the header byte
+	header := byte(7)
+	data, err := EncodeFrame(testKey, make([]byte, ivSize), &header, []byte(`{"power":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := DecodeFrame(testKey, data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.JSON != nil {
+		t.Fatalf("JSON = %q decoding a response without its header", frame.JSON)
+	}
+}
+
+func TestDecodeFrameRequiresAnObject(t *testing.T) {
+	for _, plaintext := range []string{`7 garbage`, `"power"`, `[1]`, `null`} {
+		t.Run(plaintext, func(t *testing.T) {
+			data, err := EncodeFrame(testKey, make([]byte, ivSize), nil, []byte(plaintext))
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, err := DecodeFrame(testKey, data, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.JSON != nil || frame.Trailing != nil {
+				t.Fatalf("JSON = %q, trailing = %q, want none for a payload that is not an object", frame.JSON, frame.Trailing)
+			}
+		})
+	}
+}
+
+func TestDecodeFrameTooShort(t *testing.T) {
+	if _, err := DecodeFrame(testKey, make([]byte, ivSize+crcSize), true); !errors.Is(err, ErrUnexpectedResponse) {
+		t.Fatalf("DecodeFrame() error = %v, want ErrUnexpectedResponse", err)
+	}
+}
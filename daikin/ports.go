@@ -0,0 +1,104 @@
+package daikin
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// DefaultPortName is the port every AC has, and the only one of single split ones.
+const DefaultPortName = "port1"
+
+// portNumber returns N for a port named portN.
+func portNumber(name string) (int, bool) {
+	digits, ok := strings.CutPrefix(name, "port")
+	if !ok || digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// IsPortName reports whether name is the name of an indoor unit port, e.g.
+// port1 or port2.
+func IsPortName(name string) bool {
+	_, ok := portNumber(name)
+	return ok
+}
+
+func comparePortNames(a, b string) int {
+	x, _ := portNumber(a)
+	y, _ := portNumber(b)
+	return x - y
+}
+
+// PortNames returns the names of the ports sent by the AC in order, port1
+// first. It is never empty.
+func (s *State) PortNames() []string {
+	if len(s.Ports) == 0 {
+		return []string{DefaultPortName}
+	}
+	return slices.SortedFunc(maps.Keys(s.Ports), comparePortNames)
+}
+
+// Port returns the port with the given name, and whether the AC sent it.
+func (s *State) Port(name string) (Port, bool) {
+	if name == DefaultPortName && len(s.Ports) == 0 {
+		return s.Port1, true
+	}
+	p, ok := s.Ports[name]
+	return p, ok
+}
+
+// PoweredOn reports whether any of the ports is on.
+func (s *State) PoweredOn() bool {
+	for _, name := range s.PortNames() {
+		if p, _ := s.Port(name); p.Power != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// MarshalJSON writes every port under its name, like the AC sends them, along
+// with the top level fields that are not known yet.
+func (s State) MarshalJSON() ([]byte, error) {
+	object := make(map[string]any, len(s.Extra)+len(s.Ports)+1)
+	for key, value := range s.Extra {
+		object[key] = value
+	}
+	object["idu"] = s.Idu
+	for _, name := range s.PortNames() {
+		object[name], _ = s.Port(name)
+	}
+	return json.Marshal(object)
+}
+
+// NewDesiredState returns the desired state changing a single port.
+func NewDesiredState(port string, state PortState) (DesiredState, error) {
+	if !IsPortName(port) {
+		return DesiredState{}, fmt.Errorf("invalid port %q, expected something like port1", port)
+	}
+	if port == DefaultPortName {
+		return DesiredState{Port1: state}, nil
+	}
+	return DesiredState{Ports: map[string]PortState{port: state}}, nil
+}
+
+// MarshalJSON writes Port1 and every port in Ports under their names.
+func (d DesiredState) MarshalJSON() ([]byte, error) {
+	ports := maps.Clone(d.Ports)
+	if ports == nil {
+		ports = make(map[string]PortState)
+	}
+	if _, ok := ports[DefaultPortName]; !ok && (d.Port1 != PortState{} || len(ports) == 0) {
+		ports[DefaultPortName] = d.Port1
+	}
+	return json.Marshal(ports)
+}
@@ -0,0 +1,209 @@
+package daikin
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestStateUnmarshalPorts(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantPorts []string
+		wantExtra []string
+	}{
+		{
+			name:      "single split",
+			data:      `{"port1":{"power":1,"mode":3,"temperature":23},"idu":1}`,
+			wantPorts: []string{"port1"},
+		},
+		{
+			name:      "multi split",
+			data:      `{"port1":{"power":1,"mode":3,"temperature":23},"port2":{"power":0,"mode":4,"temperature":25},"port10":{"power":1,"mode":6,"temperature":20},"idu":3}`,
+			wantPorts: []string{"port1", "port2", "port10"},
+		},
+		{
+			name:      "without port1",
+			data:      `{"port2":{"power":1,"mode":4,"temperature":25},"idu":1}`,
+			wantPorts: []string{"port2"},
+		},
+		{
+			name:      "unknown top level fields",
+			data:      `{"port1":{"power":1},"idu":1,"portx":{},"rssi":-60}`,
+			wantPorts: []string{"port1"},
+			wantExtra: []string{"portx", "rssi"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state State
+			if err := json.Unmarshal([]byte(tt.data), &state); err != nil {
+				t.Fatal(err)
+			}
+			if got := state.PortNames(); !slices.Equal(got, tt.wantPorts) {
+				t.Fatalf("PortNames() = %v, want %v", got, tt.wantPorts)
+			}
+			if got := slices.Sorted(maps.Keys(state.Extra)); !slices.Equal(got, tt.wantExtra) {
+				t.Fatalf("Extra = %v, want %v", got, tt.wantExtra)
+			}
+		})
+	}
+}
+
+func TestStateUnmarshalPortValues(t *testing.T) {
+	var state State
+	data := `{"port1":{"power":1,"mode":3,"temperature":23,"fan":17},"port2":{"power":1,"mode":4,"temperature":25.5,"fan":3,"humidity":40}}`
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		t.Fatal(err)
+	}
+	p1, ok := state.Port("port1")
+	if !ok || !reflect.DeepEqual(p1, state.Port1) || p1.Mode != ModeCool || p1.Fan != FanAuto {
+		t.Fatalf("port1 = %+v, %v, want cool at auto fan matching Port1", p1, ok)
+	}
+	p2, ok := state.Port("port2")
+	if !ok || p2.Mode != ModeHeat || p2.Temperature != 25.5 || p2.Fan != FanLow {
+		t.Fatalf("port2 = %+v, %v, want heat at 25.5 and low fan", p2, ok)
+	}
+	if string(p2.Extra["humidity"]) != "40" {
+		t.Fatalf("port2 extra = %v, want humidity", p2.Extra)
+	}
+	if _, ok := state.Port("port3"); ok {
+		t.Fatal("Port(port3) found on an AC without it")
+	}
+}
+
+func TestStateMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "single split",
+			data: `{"port1":{"power":1,"mode":3},"idu":1}`,
+			want: `{"idu":1,"port1":{"power":1,"mode":3}}`,
+		},
+		{
+			name: "multi split",
+			data: `{"port1":{"power":1,"mode":3},"port2":{"power":0,"mode":4},"idu":2}`,
+			want: `{"idu":2,"port1":{"power":1,"mode":3},"port2":{"power":0,"mode":4}}`,
+		},
+		{
+			name: "unknown top level fields",
+			data: `{"port1":{"power":1,"mode":3},"idu":1,"rssi":-60,"wifi":{"ch":6}}`,
+			want: `{"idu":1,"port1":{"power":1,"mode":3},"rssi":-60,"wifi":{"ch":6}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var state State
+			if err := json.Unmarshal([]byte(tt.data), &state); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.Marshal(state)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want map[string]json.RawMessage
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(slices.Sorted(maps.Keys(got)), slices.Sorted(maps.Keys(want))) {
+				t.Fatalf("MarshalJSON() = %s, want the keys of %s", data, tt.want)
+			}
+			for key, value := range want {
+				// the ports are written with every field, so they are compared
+				// decoded
+				if IsPortName(key) {
+					var gotPort, wantPort Port
+					_ = json.Unmarshal(got[key], &gotPort)
+					_ = json.Unmarshal(value, &wantPort)
+					if !reflect.DeepEqual(gotPort, wantPort) {
+						t.Errorf("%s = %s, want %s", key, got[key], value)
+					}
+					continue
+				}
+				if string(got[key]) != string(value) {
+					t.Errorf("%s = %s, want %s", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDesiredState(t *testing.T) {
+	power := 1
+	state := PortState{Power: &power}
+	tests := []struct {
+		name    string
+		port    string
+		want    DesiredState
+		wantErr bool
+	}{
+		{name: "port1", port: "port1", want: DesiredState{Port1: state}},
+		{name: "other port", port: "port2", want: DesiredState{Ports: map[string]PortState{"port2": state}}},
+		{name: "invalid port", port: "port0", wantErr: true},
+		{name: "not a port", port: "idu", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDesiredState(tt.port, state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewDesiredState() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Port1 != tt.want.Port1 || len(got.Ports) != len(tt.want.Ports) {
+				t.Fatalf("NewDesiredState() = %+v, want %+v", got, tt.want)
+			}
+			for name, p := range tt.want.Ports {
+				if got.Ports[name] != p {
+					t.Fatalf("NewDesiredState() port %s = %+v, want %+v", name, got.Ports[name], p)
+				}
+			}
+		})
+	}
+}
+
+func TestDesiredStateMarshalJSON(t *testing.T) {
+	power, temperature, mode := 1, 23.0, ModeCool
+	tests := []struct {
+		name    string
+		desired DesiredState
+		want    string
+	}{
+		{name: "empty", desired: DesiredState{}, want: `{"port1":{}}`},
+		{name: "port1", desired: DesiredState{Port1: PortState{Power: &power, Mode: &mode}}, want: `{"port1":{"power":1,"mode":3}}`},
+		{
+			name:    "other port",
+			desired: DesiredState{Ports: map[string]PortState{"port2": {Temperature: &temperature}}},
+			want:    `{"port2":{"temperature":23}}`,
+		},
+		{
+			name: "several ports",
+			desired: DesiredState{
+				Port1: PortState{Power: &power},
+				Ports: map[string]PortState{"port2": {Temperature: &temperature}},
+			},
+			want: `{"port1":{"power":1},"port2":{"temperature":23}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.desired)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Fatalf("MarshalJSON() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
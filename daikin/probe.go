@@ -0,0 +1,85 @@
+package daikin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Diagnosis classifies the outcome of talking to an AC.
+type Diagnosis string
+
+const (
+	DiagnosisOK Diagnosis = "ok"
+	// DiagnosisUnreachable means nothing answered at the address.
+	DiagnosisUnreachable Diagnosis = "unreachable"
+	// DiagnosisWrongEndpoint means something answered, but not like an AC does.
+	DiagnosisWrongEndpoint Diagnosis = "wrong_endpoint"
+	// DiagnosisWrongKey means the AC answered but its payload does not decrypt
+	// to JSON with the configured secret key.
+	DiagnosisWrongKey Diagnosis = "wrong_key"
+	// DiagnosisInvalidResponse means the response was corrupted.
+	DiagnosisInvalidResponse Diagnosis = "invalid_response"
+	DiagnosisUnknown         Diagnosis = "unknown"
+)
+
+// Diagnoses lists every Diagnosis.
+var Diagnoses = []Diagnosis{
+	DiagnosisOK,
+	DiagnosisUnreachable,
+	DiagnosisWrongEndpoint,
+	DiagnosisWrongKey,
+	DiagnosisInvalidResponse,
+	DiagnosisUnknown,
+}
+
+// Diagnose classifies an error returned by the client.
+func Diagnose(err error) Diagnosis {
+	switch {
+	case err == nil:
+		return DiagnosisOK
+	case errors.Is(err, ErrUnreachable):
+		return DiagnosisUnreachable
+	case errors.Is(err, ErrUnexpectedResponse):
+		return DiagnosisWrongEndpoint
+	case errors.Is(err, ErrWrongKey):
+		return DiagnosisWrongKey
+	case errors.Is(err, ErrInvalidCRC):
+		return DiagnosisInvalidResponse
+	default:
+		return DiagnosisUnknown
+	}
+}
+
+// IsTimeout reports whether err is a request to the AC that timed out, a kind
+// of DiagnosisUnreachable.
+func IsTimeout(err error) bool {
+	return errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// ProbeResult is the outcome of Probe.
+type ProbeResult struct {
+	Diagnosis Diagnosis
+	// Endpoint is the path that failed, empty when both answered.
+	Endpoint string
+	Err      error
+	Status   *StatusResponse
+	State    *State
+}
+
+// Probe checks that both /acstatus and /status answer and decrypt to valid JSON
+// with the secret key, to tell apart an unreachable AC, a wrong address and a
+// wrong key before polling it. State is set whenever /acstatus works, even if
+// /status then fails, since only the former is needed to control the AC.
+func (c *Client) Probe(ctx context.Context) ProbeResult {
+	state, err := c.State(ctx)
+	if err != nil {
+		return ProbeResult{Diagnosis: Diagnose(err), Endpoint: "/acstatus", Err: err}
+	}
+	status, err := c.Status(ctx)
+	if err != nil {
+		return ProbeResult{Diagnosis: Diagnose(err), Endpoint: "/status", Err: err, State: state}
+	}
+	return ProbeResult{Diagnosis: DiagnosisOK, Status: status, State: state}
+}
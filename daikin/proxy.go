@@ -0,0 +1,129 @@
+package daikin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Exchange is a request made to the AC through the Proxy and its response, with
+// both bodies decrypted.
+type Exchange struct {
+	Time     time.Time       `json:"time"`
+	Method   string          `json:"method"`
+	Path     string          `json:"path"`
+	Status   int             `json:"status"`
+	Duration time.Duration   `json:"duration"`
+	Request  json.RawMessage `json:"request,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+	// RequestTrailing and ResponseTrailing are the bytes following the JSON in
+	// the decrypted bodies, like the "BZ" ending the requests.
+	RequestTrailing  string `json:"request_trailing,omitempty"`
+	ResponseTrailing string `json:"response_trailing,omitempty"`
+	// ResponseHeader is the byte between the IV and the payload of the
+	// responses that have one.
+	ResponseHeader *byte `json:"response_header,omitempty"`
+	// RawRequest and RawResponse hold the bodies as sent on the wire when they
+	// could not be decrypted.
+	RawRequest  string `json:"raw_request,omitempty"`
+	RawResponse string `json:"raw_response,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Proxy forwards every request to an AC and reports the decrypted exchange, so
+// the traffic of the official app can be recorded while it keeps working.
+type Proxy struct {
+	target    *url.URL
+	secretKey []byte
+	record    func(Exchange)
+}
+
+// NewProxy creates a *Proxy forwarding to target and calling record after
+// every exchange.
+func NewProxy(target *url.URL, secretKey []byte, record func(Exchange)) *Proxy {
+	return &Proxy{
+		target:    target,
+		secretKey: secretKey,
+		record:    record,
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	exchange := Exchange{
+		Time:   time.Now(),
+		Method: r.Method,
+		Path:   r.URL.Path,
+	}
+	defer func() {
+		exchange.Duration = time.Since(exchange.Time)
+		p.record(exchange)
+	}()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		exchange.Error = err.Error()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) > 0 {
+		frame, err := p.decode(body, false)
+		if err != nil {
+			exchange.RawRequest = string(body)
+			exchange.Error = "request: " + err.Error()
+		} else {
+			exchange.Request = frame.JSON
+			exchange.RequestTrailing = string(frame.Trailing)
+		}
+	}
+
+	target := *p.target
+	target.Path = r.URL.Path
+	target.RawQuery = r.URL.RawQuery
+	status, respBody, err := doRequest(r.Context(), r.Method, target.String(), body)
+	if err != nil {
+		exchange.Error = err.Error()
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	exchange.Status = status
+
+	if status == http.StatusOK && len(respBody) > 0 {
+		frame, err := p.decode(respBody, hasHeader(strings.TrimPrefix(r.URL.Path, "/")))
+		if err != nil {
+			exchange.RawResponse = string(respBody)
+			exchange.Error = "response: " + err.Error()
+		} else {
+			exchange.Response = frame.JSON
+			exchange.ResponseTrailing = string(frame.Trailing)
+			exchange.ResponseHeader = frame.Header
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(respBody)
+}
+
+// decode returns the frame carried by a base64 body, failing unless it holds
+// JSON with a valid CRC.
+func (p *Proxy) decode(body []byte, header bool) (*Frame, error) {
+	data, err := base64.StdEncoding.DecodeString(string(body))
+	if err != nil {
+		return nil, err
+	}
+	frame, err := DecodeFrame(p.secretKey, data, header)
+	if err != nil {
+		return nil, err
+	}
+	if !frame.ValidCRC() {
+		return nil, ErrInvalidCRC
+	}
+	if frame.JSON == nil {
+		return nil, ErrWrongKey
+	}
+	return frame, nil
+}
@@ -0,0 +1,249 @@
+package daikin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef")
+
+// testHeader is the byte the emulator sends between the IV and the payload.
+const testHeader byte = 0x01
+
+// emulator is a local stand-in for the AC, answering /acstatus and /status with
+// frames encrypted like the firmware does.
+type emulator struct {
+	t     *testing.T
+	key   []byte
+	mu    sync.Mutex
+	state map[string]map[string]any
+}
+
+func newEmulator(t *testing.T, key []byte) *httptest.Server {
+	t.Helper()
+	e := &emulator{
+		t:   t,
+		key: key,
+		state: map[string]map[string]any{
+			"port1": {"power": 1, "mode": 3, "temperature": 23, "fan": 17, "sensors": map[string]any{"room_temp": 26}},
+		},
+	}
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func (e *emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/acstatus" && r.Method == http.MethodPost:
+		body, _ := io.ReadAll(r.Body)
+		data, err := base64.StdEncoding.DecodeString(string(body))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		frame, err := DecodeFrame(e.key, data, false)
+		if err != nil || !frame.ValidCRC() || frame.JSON == nil {
+			http.Error(w, "invalid frame", http.StatusBadRequest)
+			return
+		}
+		var desired map[string]map[string]any
+		if err := json.Unmarshal(frame.JSON, &desired); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for port, fields := range desired {
+			for name, value := range fields {
+				e.state[port][name] = value
+			}
+		}
+		e.respond(w, map[string]any{"port1": e.state["port1"], "idu": 1})
+	case r.URL.Path == "/acstatus":
+		e.respond(w, map[string]any{"port1": e.state["port1"], "idu": 1})
+	case r.URL.Path == "/status":
+		e.respond(w, map[string]any{"username": "user", "sta_ssid": "home", "status": map[string]int{"ac": 1, "sta": 1, "cloud": 1, "auth": 1}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (e *emulator) respond(w http.ResponseWriter, v any) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		e.t.Error(err)
+		return
+	}
+	iv := make([]byte, ivSize)
+	rand.Read(iv)
+	header := testHeader
+	frame, err := EncodeFrame(e.key, iv, &header, plaintext)
+	if err != nil {
+		e.t.Error(err)
+		return
+	}
+	w.Write([]byte(base64.StdEncoding.EncodeToString(frame)))
+}
+
+// recordJSONL returns a record function writing the exchanges as JSON lines,
+// like the proxy command does, and a function parsing the lines written.
+func recordJSONL(t *testing.T) (func(Exchange), func() []Exchange) {
+	t.Helper()
+	var (
+		mu  sync.Mutex
+		buf bytes.Buffer
+	)
+	encoder := json.NewEncoder(&buf)
+	record := func(e Exchange) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := encoder.Encode(e); err != nil {
+			t.Error(err)
+		}
+	}
+	lines := func() []Exchange {
+		mu.Lock()
+		defer mu.Unlock()
+		var exchanges []Exchange
+		scanner := bufio.NewScanner(bytes.NewReader(buf.Bytes()))
+		for scanner.Scan() {
+			var e Exchange
+			if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+				t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+			}
+			exchanges = append(exchanges, e)
+		}
+		return exchanges
+	}
+	return record, lines
+}
+
+func startProxy(t *testing.T, target string, key []byte, record func(Exchange)) *url.URL {
+	t.Helper()
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewProxy(targetURL, key, record))
+	t.Cleanup(srv.Close)
+	proxyURL, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proxyURL
+}
+
+func TestProxyRecordsDecryptedExchanges(t *testing.T) {
+	ac := newEmulator(t, testKey)
+	record, lines := recordJSONL(t)
+	client := NewClient(startProxy(t, ac.URL, testKey, record), testKey)
+	ctx := context.Background()
+
+	state, err := client.State(ctx)
+	if err != nil {
+		t.Fatalf("State() error = %v", err)
+	}
+	if state.Port1.Temperature != 23 {
+		t.Fatalf("temperature = %v, want 23", state.Port1.Temperature)
+	}
+	temperature := 24.0
+	state, err = client.SetState(ctx, DesiredState{Port1: PortState{Temperature: &temperature}})
+	if err != nil {
+		t.Fatalf("SetState() error = %v", err)
+	}
+	if state.Port1.Temperature != 24 {
+		t.Fatalf("temperature after SetState = %v, want 24", state.Port1.Temperature)
+	}
+	if _, err := client.Status(ctx); err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+
+	exchanges := lines()
+	if len(exchanges) != 3 {
+		t.Fatalf("recorded %d exchanges, want 3", len(exchanges))
+	}
+	for _, e := range exchanges {
+		if e.Error != "" || e.Status != http.StatusOK {
+			t.Errorf("%s %s: status %d, error %q", e.Method, e.Path, e.Status, e.Error)
+		}
+		if e.ResponseHeader == nil || *e.ResponseHeader != testHeader {
+			t.Errorf("%s %s: response header = %v, want %d", e.Method, e.Path, e.ResponseHeader, testHeader)
+		}
+		if e.RawResponse != "" || e.ResponseTrailing != "" {
+			t.Errorf("%s %s: raw response %q, trailing %q", e.Method, e.Path, e.RawResponse, e.ResponseTrailing)
+		}
+	}
+
+	get, set, status := exchanges[0], exchanges[1], exchanges[2]
+	if get.Method != http.MethodGet || get.Path != "/acstatus" || get.Request != nil {
+		t.Errorf("first exchange = %s %s with request %s, want GET /acstatus without body", get.Method, get.Path, get.Request)
+	}
+	if !strings.Contains(string(get.Response), `"temperature":23`) {
+		t.Errorf("GET response = %s, want the state", get.Response)
+	}
+
+	if set.Method != http.MethodPost || set.Path != "/acstatus" {
+		t.Errorf("second exchange = %s %s, want POST /acstatus", set.Method, set.Path)
+	}
+	if string(set.Request) != `{"port1":{"temperature":24}}` {
+		t.Errorf("POST request = %s, want the desired state", set.Request)
+	}
+	if set.RequestTrailing != "BZ" {
+		t.Errorf("POST request trailing = %q, want BZ", set.RequestTrailing)
+	}
+	if !strings.Contains(string(set.Response), `"temperature":24`) {
+		t.Errorf("POST response = %s, want the changed state", set.Response)
+	}
+
+	if status.Path != "/status" || !strings.Contains(string(status.Response), `"sta_ssid":"home"`) {
+		t.Errorf("third exchange = %s %s, want /status", status.Path, status.Response)
+	}
+}
+
+func TestProxyRecordsUndecryptableBodies(t *testing.T) {
+	ac := newEmulator(t, testKey)
+	record, lines := recordJSONL(t)
+	// the proxy has the wrong key, but the app talking through it keeps working
+	client := NewClient(startProxy(t, ac.URL, []byte("fedcba9876543210"), record), testKey)
+
+	if _, err := client.State(context.Background()); err != nil {
+		t.Fatalf("State() through the proxy error = %v", err)
+	}
+	exchanges := lines()
+	if len(exchanges) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(exchanges))
+	}
+	e := exchanges[0]
+	if e.Response != nil || e.RawResponse == "" || !strings.HasPrefix(e.Error, "response: ") {
+		t.Fatalf("exchange = %+v, want the raw response and a response error", e)
+	}
+}
+
+func TestProxyUnreachableAC(t *testing.T) {
+	ac := newEmulator(t, testKey)
+	target := ac.URL
+	ac.Close()
+	record, lines := recordJSONL(t)
+	client := NewClient(startProxy(t, target, testKey, record), testKey)
+
+	if _, err := client.State(context.Background()); err == nil {
+		t.Fatal("State() error = nil, want the proxy to fail")
+	}
+	exchanges := lines()
+	if len(exchanges) != 1 || exchanges[0].Error == "" {
+		t.Fatalf("exchanges = %+v, want one with the error", exchanges)
+	}
+}
@@ -1,49 +1,194 @@
 package daikin
 
 import (
+	"encoding"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 )
 
+// MinTemperature and MaxTemperature bound the target temperature, in Celsius,
+// accepted from the users.
+const (
+	MinTemperature = 10.0
+	MaxTemperature = 32.0
+)
+
+// ValidateTemperature rejects a target temperature the ACs do not support.
+func ValidateTemperature(t float64) error {
+	if !(t >= MinTemperature && t <= MaxTemperature) { // also rejects NaN
+		return fmt.Errorf("temperature %v out of range, must be between %v and %v", t, MinTemperature, MaxTemperature)
+	}
+	return nil
+}
+
+// Mode is the operation mode of a port. It is sent to the AC as a number, and
+// has a stable English identifier as text, e.g. "cool", for the JSON APIs and
+// the logs.
 type Mode int
 
+const (
+	ModeAuto Mode = 0
+	ModeDry  Mode = 2
+	ModeCool Mode = 3
+	ModeHeat Mode = 4
+	ModeFan  Mode = 6
+)
+
+// DefaultOperationModes and DefaultFanModes are the modes offered when a device
+// does not list its own, named like Home Assistant does. "off" powers the AC off.
+var (
+	DefaultOperationModes = []string{"auto", "off", "cool", "heat", "dry", "fan_only"}
+	DefaultFanModes       = []string{"auto", "low", "medium", "high"}
+)
+
+var modeNames = map[Mode]string{
+	ModeAuto: "auto",
+	ModeDry:  "dry",
+	ModeCool: "cool",
+	ModeHeat: "heat",
+	ModeFan:  "fan_only",
+}
+
+// String returns the identifier of the mode, or its number when unknown.
 func (m Mode) String() string {
-	switch m {
-	case 0:
-		return "Automático"
-	case 2:
-		return "Desumidificar"
-	case 3:
-		return "Resfriar"
-	case 4:
-		return "Aquecer"
-	case 6:
-		return "Ventilar"
-	default:
-		return fmt.Sprintf("%d", m)
+	if name, ok := modeNames[m]; ok {
+		return name
+	}
+	return strconv.Itoa(int(m))
+}
+
+// Validate rejects a mode the AC does not have, e.g. a number given by a user.
+func (m Mode) Validate() error {
+	return validateEnum("mode", m, modeNames)
+}
+
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Mode) UnmarshalText(text []byte) error {
+	v, err := parseEnum(string(text), modeNames)
+	if err != nil {
+		return fmt.Errorf("invalid mode: %w", err)
 	}
+	*m = v
+	return nil
+}
+
+// MarshalJSON keeps the number, which is what the AC understands.
+func (m Mode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(m))
+}
+
+// UnmarshalJSON accepts the number sent by the AC or the identifier.
+func (m *Mode) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*int)(m), m)
 }
 
+// Fan is the fan speed of a port, sent and identified like Mode.
 type Fan int
 
+const (
+	FanLow        Fan = 3
+	FanMediumLow  Fan = 4
+	FanMedium     Fan = 5
+	FanMediumHigh Fan = 6
+	FanHigh       Fan = 7
+	FanAuto       Fan = 17
+	FanQuiet      Fan = 18
+)
+
+var fanNames = map[Fan]string{
+	FanLow:        "low",
+	FanMediumLow:  "medium_low",
+	FanMedium:     "medium",
+	FanMediumHigh: "medium_high",
+	FanHigh:       "high",
+	FanAuto:       "auto",
+	FanQuiet:      "quiet",
+}
+
+// String returns the identifier of the fan speed, or its number when unknown.
 func (f Fan) String() string {
-	switch f {
-	case 3:
-		return "Baixa"
-	case 4:
-		return "Média-Baixa"
-	case 5:
-		return "Média"
-	case 6:
-		return "Média-Alta"
-	case 7:
-		return "Alta"
-	case 17:
-		return "Automático"
-	case 18:
-		return "Silencioso"
-	default:
-		return fmt.Sprintf("%d", f)
+	if name, ok := fanNames[f]; ok {
+		return name
+	}
+	return strconv.Itoa(int(f))
+}
+
+// Validate rejects a fan speed the AC does not have.
+func (f Fan) Validate() error {
+	return validateEnum("fan", f, fanNames)
+}
+
+func (f Fan) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *Fan) UnmarshalText(text []byte) error {
+	v, err := parseEnum(string(text), fanNames)
+	if err != nil {
+		return fmt.Errorf("invalid fan: %w", err)
+	}
+	*f = v
+	return nil
+}
+
+// MarshalJSON keeps the number, which is what the AC understands.
+func (f Fan) MarshalJSON() ([]byte, error) {
+	return json.Marshal(int(f))
+}
+
+// UnmarshalJSON accepts the number sent by the AC or the identifier.
+func (f *Fan) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*int)(f), f)
+}
+
+// parseEnum returns the value named text, also accepting its number.
+func parseEnum[T ~int](text string, names map[T]string) (T, error) {
+	for v, name := range names {
+		if name == text {
+			return v, nil
+		}
+	}
+	if n, err := strconv.Atoi(text); err == nil {
+		if _, ok := names[T(n)]; ok {
+			return T(n), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown value %q, must be one of %s", text, enumNames(names))
+}
+
+// validateEnum rejects v when it has no name.
+func validateEnum[T ~int](kind string, v T, names map[T]string) error {
+	if _, ok := names[v]; !ok {
+		return fmt.Errorf("unknown %s %d, must be one of %s", kind, int(v), enumNames(names))
+	}
+	return nil
+}
+
+// enumNames lists the names ordered by value.
+func enumNames[T ~int](names map[T]string) string {
+	list := make([]string, 0, len(names))
+	for _, v := range slices.Sorted(maps.Keys(names)) {
+		list = append(list, names[v])
+	}
+	return strings.Join(list, ", ")
+}
+
+// unmarshalEnum decodes a JSON number into n, or a JSON string with text. Any
+// number is kept, as the firmware may send values not known yet.
+func unmarshalEnum(data []byte, n *int, text encoding.TextUnmarshaler) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return text.UnmarshalText([]byte(s))
 	}
+	return json.Unmarshal(data, n)
 }
 
 type Port struct {
@@ -66,6 +211,39 @@ type Port struct {
 	Sensors       Sensors `json:"sensors"`
 	RstR          int     `json:"rst_r"`
 	FWVer         string  `json:"fw_ver"`
+	// Extra holds the fields sent by the firmware that are not known yet, keyed
+	// by their json name. Nested ones are joined with a dot, e.g. "sensors.humidity".
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// Diff returns the json names of the fields that differ between p and other.
+// Nested fields are joined with a dot, e.g. "sensors.room_temp".
+func (p Port) Diff(other Port) []string {
+	changed := diffFields(reflect.ValueOf(p), reflect.ValueOf(other), "")
+	if !reflect.DeepEqual(p.Extra, other.Extra) {
+		changed = append(changed, "extra")
+	}
+	return changed
+}
+
+func diffFields(a, b reflect.Value, prefix string) []string {
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		name = prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			changed = append(changed, diffFields(a.Field(i), b.Field(i), name+".")...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
 }
 
 type Sensors struct {
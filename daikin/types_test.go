@@ -0,0 +1,173 @@
+package daikin
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestPortDiff(t *testing.T) {
+	base := `{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}}`
+	tests := []struct {
+		name  string
+		other string
+		want  []string
+	}{
+		{name: "unchanged", other: base, want: nil},
+		{
+			name:  "single field",
+			other: `{"power":1,"mode":3,"temperature":21,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}}`,
+			want:  []string{"temperature"},
+		},
+		{
+			name:  "nested field",
+			other: `{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":25.5,"out_temp":30}}`,
+			want:  []string{"sensors.room_temp"},
+		},
+		{
+			name:  "several fields",
+			other: `{"power":0,"mode":4,"temperature":23,"fan":3,"v_swing":1,"sensors":{"room_temp":26,"out_temp":31}}`,
+			want:  []string{"power", "mode", "fan", "v_swing", "sensors.out_temp"},
+		},
+		{
+			name:  "unknown field",
+			other: `{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30},"humidity":40}`,
+			want:  []string{"extra"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, other := testPort(t, base), testPort(t, tt.other)
+			if got := p.Diff(other); !slices.Equal(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+			if got := other.Diff(p); !slices.Equal(got, tt.want) {
+				t.Errorf("reversed Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testPort(t *testing.T, data string) Port {
+	t.Helper()
+	var p Port
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestModeText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Mode
+		wantErr bool
+	}{
+		{text: "auto", want: ModeAuto},
+		{text: "dry", want: ModeDry},
+		{text: "cool", want: ModeCool},
+		{text: "heat", want: ModeHeat},
+		{text: "fan_only", want: ModeFan},
+		{text: "3", want: ModeCool},
+		{text: "fan", wantErr: true},
+		{text: "Cool", wantErr: true},
+		{text: "5", wantErr: true},
+		{text: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var m Mode
+			err := m.UnmarshalText([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalText(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if m != tt.want {
+				t.Fatalf("UnmarshalText(%q) = %d, want %d", tt.text, m, tt.want)
+			}
+			text, err := m.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Mode
+			if err := back.UnmarshalText(text); err != nil || back != m {
+				t.Fatalf("round trip of %d through %q = %d, %v", m, text, back, err)
+			}
+		})
+	}
+}
+
+func TestFanText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    Fan
+		wantErr bool
+	}{
+		{text: "low", want: FanLow},
+		{text: "medium_low", want: FanMediumLow},
+		{text: "medium", want: FanMedium},
+		{text: "medium_high", want: FanMediumHigh},
+		{text: "high", want: FanHigh},
+		{text: "auto", want: FanAuto},
+		{text: "quiet", want: FanQuiet},
+		{text: "17", want: FanAuto},
+		{text: "turbo", wantErr: true},
+		{text: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var f Fan
+			err := f.UnmarshalText([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalText(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if f != tt.want {
+				t.Fatalf("UnmarshalText(%q) = %d, want %d", tt.text, f, tt.want)
+			}
+			text, err := f.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Fan
+			if err := back.UnmarshalText(text); err != nil || back != f {
+				t.Fatalf("round trip of %d through %q = %d, %v", f, text, back, err)
+			}
+		})
+	}
+}
+
+func TestEnumUnknownValues(t *testing.T) {
+	// the firmware may send values not known yet, which are kept as numbers
+	var port Port
+	if err := json.Unmarshal([]byte(`{"mode":5,"fan":9}`), &port); err != nil {
+		t.Fatal(err)
+	}
+	if port.Mode != 5 || port.Fan != 9 {
+		t.Fatalf("mode, fan = %d, %d, want 5, 9", port.Mode, port.Fan)
+	}
+	if port.Mode.String() != "5" || port.Fan.String() != "9" {
+		t.Fatalf("String() = %q, %q, want the numbers", port.Mode.String(), port.Fan.String())
+	}
+	if port.Mode.Validate() == nil || port.Fan.Validate() == nil {
+		t.Fatal("Validate() accepted unknown values")
+	}
+	data, err := json.Marshal(PortState{Mode: &port.Mode, Fan: &port.Fan})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"mode":5,"fan":9}` {
+		t.Fatalf("Marshal() = %s, want the numbers", data)
+	}
+	// JSON strings are the identifiers, which have to be known
+	if err := json.Unmarshal([]byte(`{"mode":"fan_only","fan":"quiet"}`), &port); err != nil || port.Mode != ModeFan || port.Fan != FanQuiet {
+		t.Fatalf("identifiers decoded to %d, %d, %v", port.Mode, port.Fan, err)
+	}
+	if err := json.Unmarshal([]byte(`{"mode":"turbo"}`), &port); err == nil {
+		t.Fatal("unknown identifier accepted")
+	}
+}
@@ -0,0 +1,153 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Bridge tracks every climate published through a MQTT connection and restores
+// their subscriptions, discovery, availability and state whenever the connection
+// is re-established. It also exposes the connection status as a binary sensor.
+type Bridge struct {
+	options   Options
+	mu        sync.Mutex
+	climates  map[string]*Climate
+	connected atomic.Bool
+}
+
+func NewBridge(opts Options) *Bridge {
+	return &Bridge{
+		options:  opts.withDefaults(),
+		climates: make(map[string]*Climate),
+	}
+}
+
+// uniqueId is derived from the base topic so several bridges can share a broker.
+func (b *Bridge) uniqueId() string {
+	return b.options.BaseTopic + "_bridge"
+}
+
+func (b *Bridge) stateTopic() string {
+	return b.options.BaseTopic + "/bridge/state"
+}
+
+// Configure registers the connection handlers and the last will of the bridge
+// on the given options.
+func (b *Bridge) Configure(opts *pahomqtt.ClientOptions) *pahomqtt.ClientOptions {
+	return opts.
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetWill(b.stateTopic(), "offline", b.options.StateQoS, true).
+		SetOnConnectHandler(b.OnConnect).
+		SetConnectionLostHandler(b.OnConnectionLost).
+		SetReconnectingHandler(func(_ pahomqtt.Client, opts *pahomqtt.ClientOptions) {
+			slog.Info("reconnecting to mqtt", slog.Any("brokers", opts.Servers))
+		})
+}
+
+// Add registers a climate to be restored on reconnection.
+func (b *Bridge) Add(c *Climate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.climates[c.UniqueId] = c
+}
+
+// Remove unregisters a climate.
+func (b *Bridge) Remove(c *Climate) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.climates, c.UniqueId)
+}
+
+// Connected reports whether the MQTT connection is currently up.
+func (b *Bridge) Connected() bool {
+	return b.connected.Load()
+}
+
+// OnConnect is called by paho on the first connection and on every reconnection.
+func (b *Bridge) OnConnect(client pahomqtt.Client) {
+	b.connected.Store(true)
+	slog.Info("connected to mqtt")
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	b.publishDiscovery(ctx, client)
+	token := client.Publish(b.stateTopic(), b.options.StateQoS, true, "online")
+	if waitToken(ctx, token) && token.Error() != nil {
+		slog.Error("failed to publish bridge state", slog.Any("error", token.Error()))
+	}
+
+	b.mu.Lock()
+	climates := make([]*Climate, 0, len(b.climates))
+	for _, c := range b.climates {
+		climates = append(climates, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range climates {
+		ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+		c.Resync(ctx)
+		cancel()
+	}
+}
+
+// OnConnectionLost is called by paho when the connection drops unexpectedly.
+func (b *Bridge) OnConnectionLost(_ pahomqtt.Client, err error) {
+	b.connected.Store(false)
+	slog.Error("mqtt connection lost", slog.Any("error", err))
+}
+
+// PublishOffline marks the bridge as offline, used on graceful shutdown where
+// the last will is not sent by the broker.
+func (b *Bridge) PublishOffline(ctx context.Context, client pahomqtt.Client) {
+	token := client.Publish(b.stateTopic(), b.options.StateQoS, true, "offline")
+	if !waitToken(ctx, token) {
+		slog.Warn("timed out setting bridge to offline")
+		return
+	}
+	if token.Error() != nil {
+		slog.Error("failed to publish bridge state", slog.Any("error", token.Error()))
+	}
+}
+
+// RemoveDiscovery clears the retained discovery config of the connection
+// sensor, used when the bridge moves to other topics.
+func (b *Bridge) RemoveDiscovery(ctx context.Context, client pahomqtt.Client) {
+	token := client.Publish(b.options.discoveryTopic("binary_sensor", b.uniqueId()), b.options.StateQoS, true, "")
+	if waitToken(ctx, token) && token.Error() != nil {
+		slog.Error("failed to remove bridge discovery", slog.Any("error", token.Error()))
+	}
+}
+
+func (b *Bridge) publishDiscovery(ctx context.Context, client pahomqtt.Client) {
+	payload, err := json.Marshal(BinarySensor{
+		Name:           b.options.Locale.Text("entity.mqtt"),
+		UniqueId:       b.uniqueId() + "_connection",
+		StateTopic:     b.stateTopic(),
+		DeviceClass:    "connectivity",
+		EntityCategory: "diagnostic",
+		PayloadOn:      "online",
+		PayloadOff:     "offline",
+		Device: Device{
+			Name:         "Daikin Smart AC Bridge",
+			Ids:          b.uniqueId(),
+			Manufacturer: "Daikin Brazil",
+		},
+	})
+	if err != nil {
+		slog.Error("failed to marshal payload", slog.Any("error", err))
+		return
+	}
+
+	token := client.Publish(b.options.discoveryTopic("binary_sensor", b.uniqueId()), b.options.StateQoS, true, payload)
+	if waitToken(ctx, token) && token.Error() != nil {
+		slog.Error("failed to publish bridge discovery", slog.Any("error", token.Error()))
+	}
+}
@@ -3,23 +3,31 @@ package ha
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
 	pahomqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
-var (
-	DefaultFanModes       = []string{"auto", "low", "medium", "high"}
-	DefaultOperationModes = []string{"auto", "off", "cool", "heat", "dry", "fan_only"}
-)
+const publishTimeout = 5 * time.Second
 
-type Climate struct {
+// AirConditioner is the subset of *daikin.Client used to poll and control an AC.
+type AirConditioner interface {
+	State(ctx context.Context) (*daikin.State, error)
+	SetState(ctx context.Context, state daikin.DesiredState) (*daikin.State, error)
+}
+
+// ClimateEntity is the discovery config of a climate entity. Every indoor unit
+// port of the AC gets one.
+type ClimateEntity struct {
 	Name                         string   `json:"name"`
 	UniqueId                     string   `json:"unique_id"`
 	Modes                        []string `json:"modes"`
@@ -38,9 +46,30 @@ type Climate struct {
 	SwingModes                   []string `json:"swing_modes"`
 	AvailabilityTopic            string   `json:"availability_topic"`
 	Device                       Device   `json:"device"`
-	daikinClient                 *daikin.Client
-	mqtt                         pahomqtt.Client
-	currentState                 *daikin.State
+}
+
+// Climate is a Daikin AC published to Home Assistant. Its embedded entity is the
+// one of port1, the entities of the other ports are added when the AC first
+// reports them.
+type Climate struct {
+	ClimateEntity
+	daikinClient   AirConditioner
+	mqtt           pahomqtt.Client
+	options        Options
+	state          *stateStore
+	scheduler      *Scheduler
+	polling        PollOptions
+	lastCommand    atomic.Int64
+	reportedFields map[string]bool
+	diagnosis      daikin.Diagnosis
+	diagnosisMu    sync.Mutex
+	status         atomic.Pointer[daikin.StatusResponse]
+	portsMu        sync.Mutex
+	ports          map[string]*ClimateEntity
+	wake           chan struct{}
+	running        atomic.Bool
+	cancel         context.CancelFunc
+	wg             sync.WaitGroup
 }
 
 type Device struct {
@@ -49,185 +78,467 @@ type Device struct {
 	Manufacturer string `json:"manufacturer"`
 }
 
-func NewClimate(daikinClient *daikin.Client, mqttClient pahomqtt.Client, name string, uniqueId string, modes []string, fanModes []string) *Climate {
+func NewClimate(daikinClient AirConditioner, mqttClient pahomqtt.Client, name string, uniqueId string, modes []string, fanModes []string, opts Options) *Climate {
+	opts = opts.withDefaults()
 	if len(modes) == 0 {
-		modes = DefaultOperationModes
+		modes = daikin.DefaultOperationModes
 	}
 	if len(fanModes) == 0 {
-		fanModes = DefaultFanModes
+		fanModes = daikin.DefaultFanModes
 	}
 	uniqueId = strings.ToLower(uniqueId)
+	device := Device{
+		Name:         name,
+		Ids:          uniqueId,
+		Manufacturer: "Daikin Brazil",
+	}
+
+	c := &Climate{
+		ClimateEntity:  newClimateEntity(opts, opts.Locale.Text("entity.climate"), uniqueId, modes, fanModes, device),
+		daikinClient:   daikinClient,
+		mqtt:           mqttClient,
+		options:        opts,
+		state:          newStateStore(),
+		scheduler:      NewScheduler(0),
+		polling:        DefaultPollOptions,
+		wake:           make(chan struct{}, 1),
+		reportedFields: make(map[string]bool),
+	}
+	c.ports = map[string]*ClimateEntity{daikin.DefaultPortName: &c.ClimateEntity}
+	return c
+}
 
-	return &Climate{
-		daikinClient:                 daikinClient,
-		mqtt:                         mqttClient,
-		Name:                         "Ar Condicionado",
+func newClimateEntity(opts Options, name string, uniqueId string, modes []string, fanModes []string, device Device) ClimateEntity {
+	return ClimateEntity{
+		Name:                         name,
 		UniqueId:                     uniqueId,
 		Modes:                        modes,
-		ModeCommandTopic:             fmt.Sprintf("daikin/%s/mode/set", uniqueId),
-		ModeStateTopic:               fmt.Sprintf("daikin/%s/mode/state", uniqueId),
+		ModeCommandTopic:             opts.topic(uniqueId, "mode/set"),
+		ModeStateTopic:               opts.topic(uniqueId, "mode/state"),
 		FanModes:                     fanModes,
-		FanModeCommandTopic:          fmt.Sprintf("daikin/%s/fan_mode/set", uniqueId),
-		FanModeStateTopic:            fmt.Sprintf("daikin/%s/fan_mode/state", uniqueId),
+		FanModeCommandTopic:          opts.topic(uniqueId, "fan_mode/set"),
+		FanModeStateTopic:            opts.topic(uniqueId, "fan_mode/state"),
 		TemperatureUnit:              "C",
 		Precision:                    float32(1),
-		TemperatureCommandTopic:      fmt.Sprintf("daikin/%s/target_temperature/set", uniqueId),
-		TemperatureStateTopic:        fmt.Sprintf("daikin/%s/target_temperature/state", uniqueId),
-		CurrentTemperatureStateTopic: fmt.Sprintf("daikin/%s/temperature/state", uniqueId),
+		TemperatureCommandTopic:      opts.topic(uniqueId, "target_temperature/set"),
+		TemperatureStateTopic:        opts.topic(uniqueId, "target_temperature/state"),
+		CurrentTemperatureStateTopic: opts.topic(uniqueId, "temperature/state"),
 		SwingModes:                   []string{"on", "off"},
-		SwingModeCommandTopic:        fmt.Sprintf("daikin/%s/swing_mode/set", uniqueId),
-		SwingModeStateTopic:          fmt.Sprintf("daikin/%s/swing_mode/state", uniqueId),
-		AvailabilityTopic:            fmt.Sprintf("daikin/%s/availability", uniqueId),
-		Device: Device{
-			Name:         name,
-			Ids:          uniqueId,
-			Manufacturer: "Daikin Brazil",
-		},
+		SwingModeCommandTopic:        opts.topic(uniqueId, "swing_mode/set"),
+		SwingModeStateTopic:          opts.topic(uniqueId, "swing_mode/state"),
+		AvailabilityTopic:            opts.topic(uniqueId, "availability"),
+		Device:                       device,
 	}
 }
 
-func (c *Climate) StateUpdate(ctx context.Context) {
-	stateCh := make(chan *daikin.State)
-	go func() {
-		for {
-			start := time.Now()
-			state, err := c.daikinClient.State(ctx)
-			duration := time.Since(start)
-			if err != nil {
-				slog.ErrorContext(ctx, "failed to get ac state", slog.String("device", c.UniqueId), slog.Any("error", err))
-			}
+// WithPolling sets the scheduler shared with the other climates and how often
+// this AC is polled. It must be called before Start.
+func (c *Climate) WithPolling(scheduler *Scheduler, opts PollOptions) *Climate {
+	c.scheduler = scheduler
+	c.polling = opts.withDefaults()
+	return c
+}
+
+// Start publishes the device as available, subscribes to its command topics and
+// polls the AC until ctx is cancelled or Stop is called.
+func (c *Climate) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+	c.running.Store(true)
+
+	c.PublishAvailable()
+	c.CommandSubscriptions()
+
+	updates, unsubscribe := c.state.Subscribe()
+	c.wg.Add(2)
+	go c.pollState(ctx, unsubscribe)
+	go c.publishStates(ctx, updates)
+	if reader, ok := c.statusReader(); ok {
+		c.wg.Add(1)
+		go c.pollStatus(ctx, reader)
+	}
+}
+
+// Stop cancels the polling, waits for the goroutines started by Start to return,
+// unsubscribes from the command topics and publishes the device as offline.
+func (c *Climate) Stop() {
+	c.running.Store(false)
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	c.unsubscribe(ctx)
+	c.PublishUnavailable(ctx)
+}
 
-			if state != nil {
-				slog.InfoContext(ctx, "retrieved ac state", slog.String("device", c.UniqueId), slog.Any("duration", duration))
-				if !reflect.DeepEqual(state, c.currentState) {
-					c.currentState = state
-					stateCh <- state
-				} else {
-					slog.InfoContext(ctx, "no state change", slog.String("device", c.UniqueId))
-				}
+// Resync republishes discovery, availability and the last known state and
+// resubscribes to the command topics. It is called after the MQTT connection is
+// re-established, since the broker may have lost both retained messages and
+// subscriptions.
+func (c *Climate) Resync(ctx context.Context) {
+	c.PublishDiscovery()
+	if !c.running.Load() {
+		c.PublishUnavailable(ctx)
+		return
+	}
+
+	c.PublishAvailable()
+	c.CommandSubscriptions()
+	if state := c.State(); state != nil {
+		c.publishState(ctx, state, nil)
+	}
+	if status := c.status.Load(); status != nil {
+		c.publishStatus(ctx, status)
+	}
+}
+
+// State returns a snapshot of the last state read from the AC, or nil if it was
+// not read yet. It is safe to call from any goroutine.
+func (c *Climate) State() *daikin.State {
+	return c.state.Snapshot()
+}
+
+// Subscribe returns a channel receiving a snapshot of every state change and a
+// function to stop receiving them.
+func (c *Climate) Subscribe() (<-chan *daikin.State, func()) {
+	return c.state.Subscribe()
+}
+
+// pollState queries the AC at the interval chosen by the polling options and
+// stores every state read. When ctx is done it calls unsubscribe, closing the
+// channel publishStates reads from.
+func (c *Climate) pollState(ctx context.Context, unsubscribe func()) {
+	defer c.wg.Done()
+	defer unsubscribe()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var unreachable bool
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-c.wake:
+		}
+
+		if !c.scheduler.acquire(ctx) {
+			return
+		}
+		pollCtx, cancel := ctx, context.CancelFunc(func() {})
+		if unreachable {
+			pollCtx, cancel = context.WithTimeout(ctx, c.polling.UnreachableTimeout)
+		}
+		start := time.Now()
+		state, err := c.daikinClient.State(pollCtx)
+		duration := time.Since(start)
+		cancel()
+		c.scheduler.release()
+		unreachable = errors.Is(err, daikin.ErrUnreachable)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "failed to get ac state", slog.String("device", c.UniqueId), slog.Any("error", err))
+		}
+		if ctx.Err() == nil {
+			c.updateDiagnosis(ctx, err)
+		}
+
+		if state != nil {
+			slog.InfoContext(ctx, "retrieved ac state", slog.String("device", c.UniqueId), slog.Any("duration", duration))
+			c.reportUnknownFields(ctx, state)
+			if !c.state.Update(state) {
+				slog.InfoContext(ctx, "no state change", slog.String("device", c.UniqueId))
 			}
+		}
+
+		next := c.polling.next(state, err, time.Unix(0, c.lastCommand.Load()))
+		timer.Reset(jitter(next, c.polling.Jitter))
+	}
+}
 
-			time.Sleep(1 * time.Second)
+// SetState sends the desired state to the AC like the MQTT commands, returning
+// the state the AC answered with. The change is published by the next poll,
+// which happens right away. It is safe to call from any goroutine.
+func (c *Climate) SetState(ctx context.Context, desired daikin.DesiredState) (*daikin.State, error) {
+	return c.setState(ctx, desired)
+}
+
+// setState sends the desired state to the AC, sharing the scheduler request
+// slots with the pollers.
+func (c *Climate) setState(ctx context.Context, desired daikin.DesiredState) (*daikin.State, error) {
+	if !c.scheduler.acquire(ctx) {
+		return nil, ctx.Err()
+	}
+	state, err := c.daikinClient.SetState(ctx, desired)
+	c.scheduler.release()
+	c.commandSent()
+	return state, err
+}
+
+// reportUnknownFields logs the fields the firmware sent that are not decoded
+// yet, once per field, so firmware changes get noticed.
+func (c *Climate) reportUnknownFields(ctx context.Context, state *daikin.State) {
+	var fields []string
+	for name := range unknownFields(state) {
+		if !c.reportedFields[name] {
+			c.reportedFields[name] = true
+			fields = append(fields, name)
 		}
-	}()
-	go func() {
-		for {
-			v, ok := <-stateCh
+	}
+	if len(fields) > 0 {
+		slices.Sort(fields)
+		slog.WarnContext(ctx, "ac sent unknown fields, the firmware may have changed", slog.String("device", c.UniqueId), slog.Any("fields", fields), slog.String("state", string(state.Raw)))
+	}
+}
+
+// commandSent switches to fast polling and polls right away, so the result of
+// a command shows up in Home Assistant quickly.
+func (c *Climate) commandSent() {
+	c.lastCommand.Store(time.Now().UnixNano())
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// publishStates publishes the topics changed by every state received from
+// updates until it is closed, and republishes the full state on every heartbeat
+// so late subscribers still converge.
+func (c *Climate) publishStates(ctx context.Context, updates <-chan *daikin.State) {
+	defer c.wg.Done()
+
+	var heartbeat <-chan time.Time
+	if c.options.HeartbeatInterval > 0 {
+		ticker := time.NewTicker(c.options.HeartbeatInterval)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	var previous *daikin.State
+	for {
+		select {
+		case v, ok := <-updates:
 			if !ok {
-				slog.InfoContext(ctx, "channel closed")
+				slog.InfoContext(ctx, "channel closed", slog.String("device", c.UniqueId))
 				return
 			}
-			fanMode := c.parseFanMode(v.Port1.Fan)
-			token := c.mqtt.Publish(c.FanModeStateTopic, 0, false, fanMode)
-			if token.Error() != nil {
-				slog.ErrorContext(ctx, "failed to publish ac fan mode state", slog.Any("error", token.Error()))
+			c.publishState(ctx, v, previous)
+			previous = v
+		case <-heartbeat:
+			if previous != nil {
+				slog.DebugContext(ctx, "republishing full state", slog.String("device", c.UniqueId))
+				c.publishState(ctx, previous, nil)
 			}
-			slog.InfoContext(ctx, "fan mode updated", slog.String("fan_mode", fanMode), slog.String("device", c.UniqueId))
+		}
+	}
+}
 
-			currentTemp := strconv.FormatFloat(v.Port1.Sensors.RoomTemp, 'f', -1, 64)
-			token = c.mqtt.Publish(c.CurrentTemperatureStateTopic, 0, false, currentTemp)
-			if token.Error() != nil {
-				slog.ErrorContext(ctx, "failed to publish ac current temperature state", slog.Any("error", token.Error()))
+// publishState publishes the topics whose values derive from a port field that
+// changed since previous. Every topic is published when previous is nil. The
+// entities of the ports seen for the first time are published and subscribed.
+func (c *Climate) publishState(ctx context.Context, v *daikin.State, previous *daikin.State) {
+	for _, port := range v.PortNames() {
+		entity, created := c.portEntity(port)
+		if created {
+			slog.InfoContext(ctx, "new indoor unit port", slog.String("device", c.UniqueId), slog.String("port", port))
+			c.publishDiscovery(entity)
+			c.subscribeCommands(port, entity)
+		}
+		current, _ := v.Port(port)
+		var last *daikin.Port
+		if previous != nil {
+			if p, ok := previous.Port(port); ok && !created {
+				last = &p
 			}
-			slog.InfoContext(ctx, "current temperature updated", slog.String("current_temperature", currentTemp), slog.String("device", c.UniqueId))
+		}
+		c.publishPort(ctx, entity, current, last)
+	}
 
-			mode := c.parseMode(v.Port1.Mode)
-			if v.Port1.Power == 0 {
-				mode = "off"
-			}
-			token = c.mqtt.Publish(c.ModeStateTopic, 0, false, mode)
-			if token.Error() != nil {
-				slog.ErrorContext(ctx, "failed to publish ac mode state", slog.Any("error", token.Error()))
-			}
-			slog.InfoContext(ctx, "mode updated", slog.String("mode", mode), slog.String("device", c.UniqueId))
+	if c.options.PublishUnknownFields {
+		fields := unknownFields(v)
+		if previous != nil && reflect.DeepEqual(fields, unknownFields(previous)) {
+			return
+		}
+		attributes, err := json.Marshal(fields)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to marshal unknown fields", slog.Any("error", err))
+		} else {
+			c.mqtt.Publish(c.unknownFieldsAttributesTopic(), c.options.StateQoS, c.options.RetainState, attributes)
+			c.mqtt.Publish(c.unknownFieldsTopic(), c.options.StateQoS, c.options.RetainState, strconv.Itoa(len(fields)))
+		}
+	}
+}
 
-			swingMode := c.parseSwing(v.Port1.VSwing)
-			token = c.mqtt.Publish(c.SwingModeStateTopic, 0, false, swingMode)
-			if token.Error() != nil {
-				slog.ErrorContext(ctx, "failed to publish ac swing mode state", slog.Any("error", token.Error()))
-			}
-			slog.InfoContext(ctx, "swing mode updated", slog.String("swing_mode", swingMode), slog.String("device", c.UniqueId))
+// publishPort publishes the topics of the entity of a port whose values derive
+// from a field that changed since previous, or every topic when it is nil.
+func (c *Climate) publishPort(ctx context.Context, e *ClimateEntity, v daikin.Port, previous *daikin.Port) {
+	var diff []string
+	if previous != nil {
+		diff = v.Diff(*previous)
+	}
+	changed := func(fields ...string) bool {
+		if previous == nil {
+			return true
+		}
+		return slices.ContainsFunc(fields, func(f string) bool { return slices.Contains(diff, f) })
+	}
 
-			targetTemp := strconv.FormatFloat(v.Port1.Temperature, 'f', -1, 64)
-			token = c.mqtt.Publish(c.TemperatureStateTopic, 0, false, targetTemp)
-			if token.Error() != nil {
-				slog.ErrorContext(ctx, "failed to publish ac target temperature state", slog.Any("error", token.Error()))
-			}
-			slog.InfoContext(ctx, "target temperature updated", slog.String("target_temperature", targetTemp), slog.String("device", c.UniqueId))
+	if changed("fan") {
+		fanMode := c.parseFanMode(v.Fan)
+		token := c.mqtt.Publish(e.FanModeStateTopic, c.options.StateQoS, c.options.RetainState, fanMode)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac fan mode state", slog.Any("error", token.Error()))
 		}
-	}()
-}
+		slog.InfoContext(ctx, "fan mode updated", slog.String("fan_mode", fanMode), slog.String("device", e.UniqueId))
+	}
 
-func (c *Climate) CommandSubscriptions() {
-	fanMode := c.mqtt.Subscribe(c.FanModeCommandTopic, 0, c.handleFanMode)
-	go func() {
-		_ = fanMode.Wait()
-		if fanMode.Error() != nil {
-			slog.Error("error subscribing", slog.Any("error", fanMode.Error()))
-		} else {
-			slog.Info("subscribed to topic", slog.String("topic", c.FanModeCommandTopic))
+	if changed("sensors.room_temp") {
+		currentTemp := strconv.FormatFloat(v.Sensors.RoomTemp, 'f', -1, 64)
+		token := c.mqtt.Publish(e.CurrentTemperatureStateTopic, c.options.StateQoS, c.options.RetainState, currentTemp)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac current temperature state", slog.Any("error", token.Error()))
 		}
-	}()
+		slog.InfoContext(ctx, "current temperature updated", slog.String("current_temperature", currentTemp), slog.String("device", e.UniqueId))
+	}
 
-	operationMode := c.mqtt.Subscribe(c.ModeCommandTopic, 0, c.handleMode)
-	go func() {
-		_ = operationMode.Wait()
-		if operationMode.Error() != nil {
-			slog.Error("error subscribing", slog.Any("error", operationMode.Error()))
-		} else {
-			slog.Info("subscribed to topic", slog.String("topic", c.ModeCommandTopic))
+	if changed("mode", "power") {
+		mode := c.parseMode(v.Mode)
+		if v.Power == 0 {
+			mode = "off"
 		}
-	}()
+		token := c.mqtt.Publish(e.ModeStateTopic, c.options.StateQoS, c.options.RetainState, mode)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac mode state", slog.Any("error", token.Error()))
+		}
+		slog.InfoContext(ctx, "mode updated", slog.String("mode", mode), slog.String("device", e.UniqueId))
+	}
 
-	targetTemp := c.mqtt.Subscribe(c.TemperatureCommandTopic, 0, c.handleTargetTemp)
-	go func() {
-		_ = targetTemp.Wait()
-		if targetTemp.Error() != nil {
-			slog.Error("error subscribing", slog.Any("error", targetTemp.Error()))
-		} else {
-			slog.Info("subscribed to topic", slog.String("topic", c.TemperatureCommandTopic))
+	if changed("v_swing") {
+		swingMode := c.parseSwing(v.VSwing)
+		token := c.mqtt.Publish(e.SwingModeStateTopic, c.options.StateQoS, c.options.RetainState, swingMode)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac swing mode state", slog.Any("error", token.Error()))
 		}
-	}()
+		slog.InfoContext(ctx, "swing mode updated", slog.String("swing_mode", swingMode), slog.String("device", e.UniqueId))
+	}
 
-	swingMode := c.mqtt.Subscribe(c.SwingModeCommandTopic, 0, c.handleswingMode)
-	go func() {
-		_ = swingMode.Wait()
-		if swingMode.Error() != nil {
-			slog.Error("error subscribing", slog.Any("error", swingMode.Error()))
-		} else {
-			slog.Info("subscribed to topic", slog.String("topic", c.SwingModeCommandTopic))
+	if changed("temperature") {
+		targetTemp := strconv.FormatFloat(v.Temperature, 'f', -1, 64)
+		token := c.mqtt.Publish(e.TemperatureStateTopic, c.options.StateQoS, c.options.RetainState, targetTemp)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac target temperature state", slog.Any("error", token.Error()))
 		}
-	}()
+		slog.InfoContext(ctx, "target temperature updated", slog.String("target_temperature", targetTemp), slog.String("device", e.UniqueId))
+	}
 }
 
+// CommandSubscriptions subscribes to the command topics of every known port.
+func (c *Climate) CommandSubscriptions() {
+	for port, entity := range c.portEntities() {
+		c.subscribeCommands(port, entity)
+	}
+}
+
+func (c *Climate) subscribeCommands(port string, e *ClimateEntity) {
+	for topic, command := range map[string]string{
+		e.FanModeCommandTopic:     CommandFanMode,
+		e.ModeCommandTopic:        CommandMode,
+		e.TemperatureCommandTopic: CommandTemperature,
+		e.SwingModeCommandTopic:   CommandSwingMode,
+	} {
+		token := c.mqtt.Subscribe(topic, c.options.CommandQoS, c.commandHandler(port, command))
+		go func() {
+			_ = token.Wait()
+			if token.Error() != nil {
+				slog.Error("error subscribing", slog.Any("error", token.Error()))
+			} else {
+				slog.Info("subscribed to topic", slog.String("topic", topic))
+			}
+		}()
+	}
+}
+
+func (c *Climate) commandTopics() []string {
+	var topics []string
+	for _, e := range c.portEntities() {
+		topics = append(topics,
+			e.FanModeCommandTopic,
+			e.ModeCommandTopic,
+			e.TemperatureCommandTopic,
+			e.SwingModeCommandTopic,
+		)
+	}
+	return topics
+}
+
+func (c *Climate) unsubscribe(ctx context.Context) {
+	token := c.mqtt.Unsubscribe(c.commandTopics()...)
+	if !waitToken(ctx, token) {
+		slog.Warn("timed out unsubscribing", slog.String("device", c.UniqueId))
+		return
+	}
+	if token.Error() != nil {
+		slog.Error("error unsubscribing", slog.String("device", c.UniqueId), slog.Any("error", token.Error()))
+	}
+}
+
+// PublishDiscovery publishes the climate entity of every known port and the
+// additional entities of the device.
 func (c *Climate) PublishDiscovery() {
-	payload, err := json.Marshal(c)
+	for _, e := range c.portEntities() {
+		c.publishDiscovery(e)
+	}
+	c.publishEntitiesDiscovery()
+}
+
+func (c *Climate) publishDiscovery(e *ClimateEntity) {
+	payload, err := json.Marshal(e)
 	if err != nil {
 		slog.Error("failed to marshal payload", slog.Any("error", err))
 	}
 
-	token := c.mqtt.Publish(c.DiscoveryTopic(), 0, true, payload)
+	token := c.mqtt.Publish(c.options.discoveryTopic("climate", e.UniqueId), c.options.StateQoS, true, payload)
 	go func() {
 		_ = token.Wait()
 		if token.Error() != nil {
-			slog.Error("failed to publish discovery", slog.String("device", c.UniqueId), slog.Any("error", token.Error()))
+			slog.Error("failed to publish discovery", slog.String("device", e.UniqueId), slog.Any("error", token.Error()))
 		}
 	}()
 }
 
+// RemoveDiscovery clears the retained discovery config, removing the entities
+// from Home Assistant.
+func (c *Climate) RemoveDiscovery() {
+	for _, e := range c.portEntities() {
+		token := c.mqtt.Publish(c.options.discoveryTopic("climate", e.UniqueId), c.options.StateQoS, true, "")
+		go func() {
+			_ = token.Wait()
+			if token.Error() != nil {
+				slog.Error("failed to remove discovery", slog.String("device", e.UniqueId), slog.Any("error", token.Error()))
+			}
+		}()
+	}
+	c.removeEntitiesDiscovery()
+}
+
+// PublishUnavailable publishes the device as offline and waits for the broker to
+// acknowledge it, giving up when ctx is done.
 func (c *Climate) PublishUnavailable(ctx context.Context) {
-	token := c.mqtt.Publish(c.AvailabilityTopic, 0, true, "offline")
-	go func() {
-		_ = token.Wait()
-		slog.Info("set device to unavailable", slog.String("device", c.UniqueId))
-		if token.Error() != nil {
-			slog.Error("failed to availability", slog.String("device", c.UniqueId), slog.Any("error", token.Error()))
-		}
-	}()
+	token := c.mqtt.Publish(c.AvailabilityTopic, c.options.StateQoS, true, "offline")
+	if !waitToken(ctx, token) {
+		slog.Warn("timed out setting device to unavailable", slog.String("device", c.UniqueId))
+		return
+	}
+	if token.Error() != nil {
+		slog.Error("failed to availability", slog.String("device", c.UniqueId), slog.Any("error", token.Error()))
+		return
+	}
+	slog.Info("set device to unavailable", slog.String("device", c.UniqueId))
 }
 
 func (c *Climate) PublishAvailable() {
-	token := c.mqtt.Publish(c.AvailabilityTopic, 0, true, "online")
+	token := c.mqtt.Publish(c.AvailabilityTopic, c.options.StateQoS, true, "online")
 	go func() {
 		_ = token.Wait()
 		if token.Error() != nil {
@@ -236,8 +547,9 @@ func (c *Climate) PublishAvailable() {
 	}()
 }
 
+// DiscoveryPayload returns the discovery config of the port1 entity.
 func (c *Climate) DiscoveryPayload() []byte {
-	payload, err := json.Marshal(c)
+	payload, err := json.Marshal(c.ClimateEntity)
 	if err != nil {
 		slog.Error("failed to marshal payload", slog.Any("error", err))
 		return []byte{}
@@ -247,111 +559,33 @@ func (c *Climate) DiscoveryPayload() []byte {
 }
 
 func (c *Climate) DiscoveryTopic() string {
-	return fmt.Sprintf("homeassistant/climate/%s/config", c.UniqueId)
+	return c.options.discoveryTopic("climate", c.UniqueId)
 }
 
-func (c *Climate) handleFanMode(_ pahomqtt.Client, msg pahomqtt.Message) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	translate := map[string]daikin.Fan{
-		"auto":   17,
-		"low":    3,
-		"medium": 5,
-		"high":   7,
-	}
-	value, ok := translate[string(msg.Payload())]
-	if !ok {
-		slog.Error("unknown value for fan mode", slog.Int("value", int(value)))
-		return
-	}
-	slog.Debug("set fan mode received", slog.String("value", value.String()))
-	_, err := c.daikinClient.SetState(ctx, daikin.DesiredState{
-		Port1: daikin.PortState{
-			Fan: &value,
-		},
-	})
-	if err != nil {
-		slog.Error("failed to send fan mode to ac", slog.String("device", c.Device.Name), slog.Any("error", err))
-	}
-}
-
-func (c *Climate) handleMode(_ pahomqtt.Client, msg pahomqtt.Message) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	payload := string(msg.Payload())
-	var desiredState = daikin.DesiredState{}
-	modesMap := map[string]daikin.Mode{
-		"auto":     0,
-		"dry":      2,
-		"cool":     3,
-		"heat":     4,
-		"fan_only": 6,
-	}
-
-	mode, ok := modesMap[payload]
-	if ok {
-		desiredState.Port1.Mode = &mode
-		desiredState.Port1.Power = intPtr(1)
-	} else if payload == "off" {
-		desiredState.Port1.Power = intPtr(0)
-	} else {
-		slog.Error("unknown mode", slog.String("payload", payload))
-		return
-	}
-	slog.Debug("set fan mode received", slog.String("payload", mode.String()))
-	_, err := c.daikinClient.SetState(ctx, desiredState)
-	if err != nil {
-		slog.Error("failed to send mode to ac", slog.String("device", c.Device.Name), slog.Any("error", err))
+// commandHandler handles the given command sent to the entity of port.
+func (c *Climate) commandHandler(port string, command string) pahomqtt.MessageHandler {
+	return func(_ pahomqtt.Client, msg pahomqtt.Message) {
+		c.handleCommand(port, command, string(msg.Payload()))
 	}
 }
 
-func (c *Climate) handleTargetTemp(_ pahomqtt.Client, msg pahomqtt.Message) {
+func (c *Climate) handleCommand(port string, command string, payload string) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	payload := string(msg.Payload())
-	slog.Debug("set temperature received", slog.String("value", payload))
-
-	targetTemp, err := strconv.ParseFloat(payload, 64)
-	if err != nil {
-		slog.ErrorContext(ctx, "string to float conversion failed", slog.Any("error", err))
+	slog.Debug("command received", slog.String("command", command), slog.String("payload", payload), slog.String("device", c.UniqueId), slog.String("port", port))
+	var portState daikin.PortState
+	if err := ApplyCommand(&portState, command, payload); err != nil {
+		slog.Error("invalid command", slog.String("device", c.UniqueId), slog.Any("error", err))
 		return
 	}
-
-	_, err = c.daikinClient.SetState(ctx, daikin.DesiredState{
-		Port1: daikin.PortState{
-			Temperature: &targetTemp,
-		},
-	})
+	desiredState, err := daikin.NewDesiredState(port, portState)
 	if err != nil {
-		slog.Error("failed to send temperature to ac", slog.String("device", c.Device.Name), slog.Any("error", err))
-	}
-}
-
-func (c *Climate) handleswingMode(_ pahomqtt.Client, msg pahomqtt.Message) {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	payload := string(msg.Payload())
-	slog.Debug("set swing mode received", slog.String("payload", payload))
-
-	swingMap := map[string]int{
-		"off": 0,
-		"on":  1,
-	}
-	value, ok := swingMap[payload]
-	if !ok {
-		slog.Error("unknown swing mode value", slog.String("payload", payload))
+		slog.Error("invalid command", slog.String("device", c.UniqueId), slog.Any("error", err))
 		return
 	}
-	_, err := c.daikinClient.SetState(ctx, daikin.DesiredState{
-		Port1: daikin.PortState{
-			VSwing: intPtr(value),
-		},
-	})
-	if err != nil {
-		slog.Error("failed to send temperature to ac", slog.String("device", c.Device.Name), slog.Any("error", err))
+	if _, err := c.setState(ctx, desiredState); err != nil {
+		slog.Error("failed to send command to ac", slog.String("command", command), slog.String("device", c.Device.Name), slog.Any("error", err))
 	}
 }
 
@@ -381,20 +615,19 @@ func (c *Climate) parseFanMode(f daikin.Fan) string {
 	}
 }
 
+// parseMode returns the Home Assistant name of the mode, which the daikin
+// package shares.
 func (c *Climate) parseMode(m daikin.Mode) string {
-	switch m {
-	case 0:
-		return "auto"
-	case 2:
-		return "dry"
-	case 3:
-		return "cool"
-	case 4:
-		return "heat"
-	case 6:
-		return "fan_only"
-	default:
-		return m.String()
+	return m.String()
+}
+
+// waitToken waits for token to complete, returning false if ctx is done first.
+func waitToken(ctx context.Context, token pahomqtt.Token) bool {
+	select {
+	case <-token.Done():
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
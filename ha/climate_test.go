@@ -0,0 +1,230 @@
+package ha
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+var testPollOptions = PollOptions{
+	Interval:            10 * time.Millisecond,
+	FastInterval:        5 * time.Millisecond,
+	FastWindow:          50 * time.Millisecond,
+	IdleInterval:        10 * time.Millisecond,
+	UnreachableInterval: 10 * time.Millisecond,
+}
+
+func newTestClimate(t *testing.T, ac AirConditioner, mqtt *fakeMQTT) *Climate {
+	t.Helper()
+	return NewClimate(ac, mqtt, "Sala", "sala", nil, nil, Options{}).
+		WithPolling(NewScheduler(2), testPollOptions)
+}
+
+func TestClimateStartStop(t *testing.T) {
+	mqtt := newFakeMQTT()
+	c := newTestClimate(t, newFakeAC(t), mqtt)
+
+	c.Start(context.Background())
+	mqtt.waitFor(t, c.AvailabilityTopic, "online")
+	mqtt.waitFor(t, c.ModeStateTopic, "cool")
+	mqtt.waitFor(t, c.TemperatureStateTopic, "23")
+	mqtt.waitFor(t, c.CurrentTemperatureStateTopic, "26")
+	for _, topic := range c.commandTopics() {
+		if !mqtt.subscribed(topic) {
+			t.Errorf("not subscribed to %q", topic)
+		}
+	}
+	if state := c.State(); state == nil || state.Port1.Temperature != 23 {
+		t.Fatalf("State() = %+v, want the polled state", state)
+	}
+
+	c.Stop()
+	if got, _ := mqtt.last(c.AvailabilityTopic); got != "offline" {
+		t.Fatalf("availability after Stop = %q, want offline", got)
+	}
+	for _, topic := range c.commandTopics() {
+		if mqtt.subscribed(topic) {
+			t.Errorf("still subscribed to %q after Stop", topic)
+		}
+	}
+}
+
+func TestClimateStopDoesNotWaitForTheAC(t *testing.T) {
+	mqtt := newFakeMQTT()
+	ac := newFakeAC(t)
+	ac.block = true
+	c := newTestClimate(t, ac, mqtt)
+
+	c.Start(context.Background())
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop() blocked on a poll in flight")
+	}
+	if got, _ := mqtt.last(c.AvailabilityTopic); got != "offline" {
+		t.Fatalf("availability after Stop = %q, want offline", got)
+	}
+}
+
+func TestClimateStopsWithContext(t *testing.T) {
+	mqtt := newFakeMQTT()
+	c := newTestClimate(t, newFakeAC(t), mqtt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Start(ctx)
+	mqtt.waitFor(t, c.ModeStateTopic, "cool")
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("goroutines still running after the context was cancelled")
+	}
+	c.Stop()
+}
+
+func TestClimateConcurrentCommands(t *testing.T) {
+	mqtt := newFakeMQTT()
+	ac := newFakeAC(t)
+	c := newTestClimate(t, ac, mqtt)
+	c.Start(context.Background())
+	defer c.Stop()
+	mqtt.waitFor(t, c.ModeStateTopic, "cool")
+
+	const commands = 20
+	var wg sync.WaitGroup
+	for i := range commands {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			temperature := strconv.Itoa(18 + i%10)
+			if !mqtt.deliver(c.TemperatureCommandTopic, temperature) {
+				t.Errorf("no handler for %q", c.TemperatureCommandTopic)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			// readers run alongside the poller and the command handlers
+			if s := c.State(); s != nil {
+				s.Port1.Temperature = -1
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(ac.commands()); got != commands {
+		t.Fatalf("AC received %d commands, want %d", got, commands)
+	}
+
+	mqtt.deliver(c.ModeCommandTopic, "heat")
+	mqtt.deliver(c.TemperatureCommandTopic, "21")
+	mqtt.waitFor(t, c.ModeStateTopic, "heat")
+	mqtt.waitFor(t, c.TemperatureStateTopic, "21")
+
+	last := ac.commands()[len(ac.commands())-1]
+	if last.Port1.Temperature == nil || *last.Port1.Temperature != 21 {
+		t.Fatalf("last command = %+v, want temperature 21", last.Port1)
+	}
+	if got := c.State().Port1.Mode; got != daikin.ModeHeat {
+		t.Fatalf("mode = %v, want heat", got)
+	}
+}
+
+func TestClimatePublishesChangedTopics(t *testing.T) {
+	const (
+		port1 = `"port1":{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}}`
+		port2 = `"port2":{"power":1,"mode":4,"temperature":25,"fan":3,"v_swing":0,"sensors":{"room_temp":20,"out_temp":30}}`
+	)
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		// want returns the topics expected to be published, and their payload.
+		want func(port1, port2 *ClimateEntity) map[string]string
+	}{
+		{
+			name:     "unchanged",
+			previous: `{` + port1 + `,` + port2 + `}`,
+			current:  `{` + port1 + `,` + port2 + `}`,
+			want:     func(_, _ *ClimateEntity) map[string]string { return nil },
+		},
+		{
+			name:     "single field",
+			previous: `{` + port1 + `}`,
+			current:  `{"port1":{"power":1,"mode":3,"temperature":21,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}}}`,
+			want: func(p1, _ *ClimateEntity) map[string]string {
+				return map[string]string{p1.TemperatureStateTopic: "21"}
+			},
+		},
+		{
+			name:     "power off publishes the mode",
+			previous: `{` + port1 + `}`,
+			current:  `{"port1":{"power":0,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}}}`,
+			want: func(p1, _ *ClimateEntity) map[string]string {
+				return map[string]string{p1.ModeStateTopic: "off"}
+			},
+		},
+		{
+			name:     "outdoor temperature has no topic",
+			previous: `{` + port1 + `}`,
+			current:  `{"port1":{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":33}}}`,
+			want:     func(_, _ *ClimateEntity) map[string]string { return nil },
+		},
+		{
+			name:     "second port only",
+			previous: `{` + port1 + `,` + port2 + `}`,
+			current:  `{` + port1 + `,"port2":{"power":1,"mode":4,"temperature":25,"fan":7,"v_swing":1,"sensors":{"room_temp":20,"out_temp":30}}}`,
+			want: func(_, p2 *ClimateEntity) map[string]string {
+				return map[string]string{p2.FanModeStateTopic: "high", p2.SwingModeStateTopic: "on"}
+			},
+		},
+		{
+			name:     "both ports",
+			previous: `{` + port1 + `,` + port2 + `}`,
+			current:  `{"port1":{"power":1,"mode":6,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}},"port2":{"power":1,"mode":4,"temperature":25,"fan":3,"v_swing":0,"sensors":{"room_temp":21,"out_temp":30}}}`,
+			want: func(p1, p2 *ClimateEntity) map[string]string {
+				return map[string]string{p1.ModeStateTopic: "fan_only", p2.CurrentTemperatureStateTopic: "21"}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqtt := newFakeMQTT()
+			c := newTestClimate(t, newFakeAC(t), mqtt)
+			ctx := context.Background()
+			previous, current := testState(t, tt.previous), testState(t, tt.current)
+			c.publishState(ctx, previous, nil)
+			mqtt.reset()
+
+			c.publishState(ctx, current, previous)
+
+			entities := c.portEntities()
+			want := tt.want(entities["port1"], entities["port2"])
+			got := mqtt.topics()
+			if len(got) != len(want) {
+				t.Fatalf("published to %v, want %v", got, want)
+			}
+			for topic, payload := range want {
+				if last, ok := mqtt.last(topic); !ok || last != payload {
+					t.Errorf("topic %q = %q (published %v), want %q", topic, last, ok, payload)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package ha
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// Commands understood by ApplyCommand, named after the Home Assistant climate
+// command topics.
+const (
+	CommandMode        = "mode"
+	CommandFanMode     = "fan_mode"
+	CommandSwingMode   = "swing_mode"
+	CommandTemperature = "temperature"
+)
+
+var (
+	modeValues = map[string]daikin.Mode{
+		"auto":     daikin.ModeAuto,
+		"dry":      daikin.ModeDry,
+		"cool":     daikin.ModeCool,
+		"heat":     daikin.ModeHeat,
+		"fan_only": daikin.ModeFan,
+	}
+	fanModeValues = map[string]daikin.Fan{
+		"auto":   daikin.FanAuto,
+		"low":    daikin.FanLow,
+		"medium": daikin.FanMedium,
+		"high":   daikin.FanHigh,
+	}
+	swingModeValues = map[string]int{
+		"off": 0,
+		"on":  1,
+	}
+)
+
+// ApplyCommand sets on port the fields changed by a Home Assistant command,
+// e.g. CommandMode with "cool" or CommandTemperature with "23".
+func ApplyCommand(port *daikin.PortState, command string, value string) error {
+	switch command {
+	case CommandMode:
+		if value == "off" {
+			port.Power = intPtr(0)
+			return nil
+		}
+		mode, ok := modeValues[value]
+		if !ok {
+			return fmt.Errorf("unknown mode %q", value)
+		}
+		port.Mode = &mode
+		port.Power = intPtr(1)
+	case CommandFanMode:
+		fan, ok := fanModeValues[value]
+		if !ok {
+			return fmt.Errorf("unknown fan mode %q", value)
+		}
+		port.Fan = &fan
+	case CommandSwingMode:
+		swing, ok := swingModeValues[value]
+		if !ok {
+			return fmt.Errorf("unknown swing mode %q", value)
+		}
+		port.VSwing = &swing
+	case CommandTemperature:
+		temperature, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid temperature %q", value)
+		}
+		if err := daikin.ValidateTemperature(temperature); err != nil {
+			return err
+		}
+		port.Temperature = &temperature
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
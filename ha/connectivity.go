@@ -0,0 +1,129 @@
+package ha
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// StatusReader is implemented by the clients able to query the connectivity
+// status of the AC. When the client of a climate implements it, the status is
+// polled every PollOptions.StatusInterval and published as diagnostic entities.
+type StatusReader interface {
+	Status(ctx context.Context) (*daikin.StatusResponse, error)
+}
+
+// connectivity describes a flag of daikin.Status published as a binary sensor.
+type connectivity struct {
+	key   string
+	value func(daikin.Status) int
+}
+
+var connectivityFlags = []connectivity{
+	{key: "cloud", value: func(s daikin.Status) int { return s.Cloud }},
+	{key: "wifi", value: func(s daikin.Status) int { return s.STA }},
+	{key: "ac_link", value: func(s daikin.Status) int { return s.AC }},
+}
+
+func (c *Climate) statusReader() (StatusReader, bool) {
+	reader, ok := c.daikinClient.(StatusReader)
+	return reader, ok
+}
+
+// connectivityEntities returns the diagnostic entities fed by the /status
+// endpoint, or none when the client cannot query it.
+func (c *Climate) connectivityEntities() []entity {
+	if _, ok := c.statusReader(); !ok {
+		return nil
+	}
+	entities := make([]entity, 0, len(connectivityFlags)+1)
+	for _, flag := range connectivityFlags {
+		uniqueId := c.UniqueId + "_" + flag.key
+		entities = append(entities, entity{
+			component: "binary_sensor",
+			uniqueId:  uniqueId,
+			config: BinarySensor{
+				Name:              c.options.Locale.Text("entity." + flag.key),
+				UniqueId:          uniqueId,
+				StateTopic:        c.connectivityTopic(flag.key),
+				AvailabilityTopic: c.AvailabilityTopic,
+				DeviceClass:       "connectivity",
+				EntityCategory:    "diagnostic",
+				PayloadOn:         "ON",
+				PayloadOff:        "OFF",
+				Device:            c.Device,
+			},
+		})
+	}
+	uniqueId := c.UniqueId + "_ssid"
+	entities = append(entities, entity{
+		component: "sensor",
+		uniqueId:  uniqueId,
+		config: Sensor{
+			Name:              c.options.Locale.Text("entity.ssid"),
+			UniqueId:          uniqueId,
+			StateTopic:        c.connectivityTopic("ssid"),
+			AvailabilityTopic: c.AvailabilityTopic,
+			EntityCategory:    "diagnostic",
+			Icon:              "mdi:wifi",
+			Device:            c.Device,
+		},
+	})
+	return entities
+}
+
+func (c *Climate) connectivityTopic(key string) string {
+	return c.options.topic(c.UniqueId, key+"/state")
+}
+
+// pollStatus queries the connectivity status of the AC every
+// PollOptions.StatusInterval until ctx is done.
+func (c *Climate) pollStatus(ctx context.Context, reader StatusReader) {
+	defer c.wg.Done()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if !c.scheduler.acquire(ctx) {
+			return
+		}
+		status, err := reader.Status(ctx)
+		c.scheduler.release()
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.ErrorContext(ctx, "failed to get ac status", slog.String("device", c.UniqueId), slog.Any("error", err))
+		case err == nil:
+			c.status.Store(status)
+			c.publishStatus(ctx, status)
+		}
+		timer.Reset(jitter(c.polling.StatusInterval, c.polling.Jitter))
+	}
+}
+
+// publishStatus publishes the connectivity flags and the SSID the AC is
+// connected to.
+func (c *Climate) publishStatus(ctx context.Context, status *daikin.StatusResponse) {
+	for _, flag := range connectivityFlags {
+		payload := "OFF"
+		if flag.value(status.Status) == 1 {
+			payload = "ON"
+		}
+		token := c.mqtt.Publish(c.connectivityTopic(flag.key), c.options.StateQoS, c.options.RetainState, payload)
+		if token.Error() != nil {
+			slog.ErrorContext(ctx, "failed to publish ac status", slog.String("flag", flag.key), slog.Any("error", token.Error()))
+		}
+	}
+	token := c.mqtt.Publish(c.connectivityTopic("ssid"), c.options.StateQoS, c.options.RetainState, status.StationSSID)
+	if token.Error() != nil {
+		slog.ErrorContext(ctx, "failed to publish ac ssid", slog.Any("error", token.Error()))
+	}
+	slog.DebugContext(ctx, "status updated", slog.String("device", c.UniqueId), slog.String("ssid", status.StationSSID), slog.Any("status", status.Status))
+}
@@ -0,0 +1,81 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+type diagnosisAttributes struct {
+	Message   string    `json:"message"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func (c *Climate) diagnosticSensor() entity {
+	uniqueId := c.UniqueId + "_diagnostic"
+	options := make([]string, 0, len(daikin.Diagnoses))
+	for _, d := range daikin.Diagnoses {
+		options = append(options, string(d))
+	}
+	return entity{
+		component: "sensor",
+		uniqueId:  uniqueId,
+		config: Sensor{
+			Name:                c.options.Locale.Text("entity.diagnostic"),
+			UniqueId:            uniqueId,
+			StateTopic:          c.options.topic(c.UniqueId, "diagnostic/state"),
+			JsonAttributesTopic: c.options.topic(c.UniqueId, "diagnostic/attributes"),
+			DeviceClass:         "enum",
+			Options:             options,
+			EntityCategory:      "diagnostic",
+			Icon:                "mdi:stethoscope",
+			Device:              c.Device,
+		},
+	}
+}
+
+// PublishDiagnosis publishes the outcome of probing the AC, so a wrong address
+// or secret key shows up in Home Assistant instead of only in the log.
+func (c *Climate) PublishDiagnosis(ctx context.Context, result daikin.ProbeResult) {
+	c.diagnosisMu.Lock()
+	c.diagnosis = result.Diagnosis
+	c.diagnosisMu.Unlock()
+
+	attributes := diagnosisAttributes{
+		Message:   c.options.Locale.Text("diagnosis." + string(result.Diagnosis)),
+		Endpoint:  result.Endpoint,
+		CheckedAt: time.Now(),
+	}
+	if result.Err != nil {
+		attributes.Error = result.Err.Error()
+	}
+	payload, err := json.Marshal(attributes)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to marshal diagnosis", slog.Any("error", err))
+		return
+	}
+	c.publishRetained(c.options.topic(c.UniqueId, "diagnostic/attributes"), payload)
+	c.publishRetained(c.options.topic(c.UniqueId, "diagnostic/state"), string(result.Diagnosis))
+}
+
+// updateDiagnosis republishes the diagnosis when the outcome of a poll is
+// classified differently from the previous one.
+func (c *Climate) updateDiagnosis(ctx context.Context, err error) {
+	diagnosis := daikin.Diagnose(err)
+	c.diagnosisMu.Lock()
+	changed := diagnosis != c.diagnosis
+	c.diagnosisMu.Unlock()
+	if !changed {
+		return
+	}
+	result := daikin.ProbeResult{Diagnosis: diagnosis, Err: err}
+	if err != nil {
+		result.Endpoint = "/acstatus"
+	}
+	c.PublishDiagnosis(ctx, result)
+}
@@ -0,0 +1,114 @@
+package ha
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+type BinarySensor struct {
+	Name              string `json:"name"`
+	UniqueId          string `json:"unique_id"`
+	StateTopic        string `json:"state_topic"`
+	AvailabilityTopic string `json:"availability_topic,omitempty"`
+	DeviceClass       string `json:"device_class,omitempty"`
+	EntityCategory    string `json:"entity_category,omitempty"`
+	PayloadOn         string `json:"payload_on"`
+	PayloadOff        string `json:"payload_off"`
+	Device            Device `json:"device"`
+}
+
+type Sensor struct {
+	Name                string   `json:"name"`
+	UniqueId            string   `json:"unique_id"`
+	StateTopic          string   `json:"state_topic"`
+	JsonAttributesTopic string   `json:"json_attributes_topic,omitempty"`
+	AvailabilityTopic   string   `json:"availability_topic,omitempty"`
+	DeviceClass         string   `json:"device_class,omitempty"`
+	Options             []string `json:"options,omitempty"`
+	EntityCategory      string   `json:"entity_category,omitempty"`
+	Icon                string   `json:"icon,omitempty"`
+	Device              Device   `json:"device"`
+}
+
+// entity is an additional entity published under the device of a climate.
+type entity struct {
+	component string
+	uniqueId  string
+	config    any
+}
+
+// entities returns the additional entities enabled for the climate.
+func (c *Climate) entities() []entity {
+	entities := []entity{c.diagnosticSensor()}
+	entities = append(entities, c.connectivityEntities()...)
+	if c.options.PublishUnknownFields {
+		uniqueId := c.UniqueId + "_unknown_fields"
+		entities = append(entities, entity{
+			component: "sensor",
+			uniqueId:  uniqueId,
+			config: Sensor{
+				Name:                c.options.Locale.Text("entity.unknown_fields"),
+				UniqueId:            uniqueId,
+				StateTopic:          c.unknownFieldsTopic(),
+				JsonAttributesTopic: c.unknownFieldsAttributesTopic(),
+				EntityCategory:      "diagnostic",
+				Icon:                "mdi:help-circle-outline",
+				Device:              c.Device,
+			},
+		})
+	}
+	return entities
+}
+
+func (c *Climate) publishEntitiesDiscovery() {
+	for _, e := range c.entities() {
+		payload, err := json.Marshal(e.config)
+		if err != nil {
+			slog.Error("failed to marshal payload", slog.Any("error", err))
+			continue
+		}
+		c.publishRetained(c.options.discoveryTopic(e.component, e.uniqueId), payload)
+	}
+}
+
+func (c *Climate) removeEntitiesDiscovery() {
+	for _, e := range c.entities() {
+		c.publishRetained(c.options.discoveryTopic(e.component, e.uniqueId), "")
+	}
+}
+
+// publishRetained publishes a retained message without waiting for it.
+func (c *Climate) publishRetained(topic string, payload any) {
+	token := c.mqtt.Publish(topic, c.options.StateQoS, true, payload)
+	go func() {
+		_ = token.Wait()
+		if token.Error() != nil {
+			slog.Error("failed to publish", slog.String("topic", topic), slog.String("device", c.UniqueId), slog.Any("error", token.Error()))
+		}
+	}()
+}
+
+func (c *Climate) unknownFieldsTopic() string {
+	return c.options.topic(c.UniqueId, "unknown_fields/state")
+}
+
+func (c *Climate) unknownFieldsAttributesTopic() string {
+	return c.options.topic(c.UniqueId, "unknown_fields/attributes")
+}
+
+// unknownFields merges the fields the firmware sent that are not decoded yet.
+func unknownFields(v *daikin.State) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage, len(v.Extra))
+	for k, value := range v.Extra {
+		fields[k] = value
+	}
+	for _, name := range v.PortNames() {
+		port, _ := v.Port(name)
+		for k, value := range port.Extra {
+			fields[name+"."+k] = value
+		}
+	}
+	return fields
+}
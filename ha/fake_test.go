@@ -0,0 +1,245 @@
+package ha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+	pahomqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// doneToken is a token that completed with err.
+type doneToken struct{ err error }
+
+func (t doneToken) Wait() bool                     { return true }
+func (t doneToken) WaitTimeout(time.Duration) bool { return true }
+func (t doneToken) Error() error                   { return t.err }
+
+func (t doneToken) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 0 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+// fakeMQTT records the messages published and routes the messages delivered
+// with deliver to the subscribed handlers.
+type fakeMQTT struct {
+	mu        sync.Mutex
+	retained  map[string]string
+	published map[string][]string
+	handlers  map[string]pahomqtt.MessageHandler
+}
+
+var _ pahomqtt.Client = (*fakeMQTT)(nil)
+
+func newFakeMQTT() *fakeMQTT {
+	return &fakeMQTT{
+		retained:  make(map[string]string),
+		published: make(map[string][]string),
+		handlers:  make(map[string]pahomqtt.MessageHandler),
+	}
+}
+
+func (f *fakeMQTT) IsConnected() bool      { return true }
+func (f *fakeMQTT) IsConnectionOpen() bool { return true }
+func (f *fakeMQTT) Connect() pahomqtt.Token {
+	return doneToken{}
+}
+func (f *fakeMQTT) Disconnect(uint) {}
+
+func (f *fakeMQTT) Publish(topic string, _ byte, retained bool, payload interface{}) pahomqtt.Token {
+	var s string
+	switch p := payload.(type) {
+	case string:
+		s = p
+	case []byte:
+		s = string(p)
+	default:
+		return doneToken{err: fmt.Errorf("unsupported payload %T", payload)}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published[topic] = append(f.published[topic], s)
+	if retained {
+		f.retained[topic] = s
+	}
+	return doneToken{}
+}
+
+func (f *fakeMQTT) Subscribe(topic string, _ byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handlers[topic] = callback
+	return doneToken{}
+}
+
+func (f *fakeMQTT) SubscribeMultiple(filters map[string]byte, callback pahomqtt.MessageHandler) pahomqtt.Token {
+	for topic, qos := range filters {
+		f.Subscribe(topic, qos, callback)
+	}
+	return doneToken{}
+}
+
+func (f *fakeMQTT) Unsubscribe(topics ...string) pahomqtt.Token {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, topic := range topics {
+		delete(f.handlers, topic)
+	}
+	return doneToken{}
+}
+
+func (f *fakeMQTT) AddRoute(topic string, callback pahomqtt.MessageHandler) {
+	f.Subscribe(topic, 0, callback)
+}
+
+func (f *fakeMQTT) OptionsReader() pahomqtt.ClientOptionsReader {
+	return pahomqtt.NewOptionsReader(pahomqtt.NewClientOptions())
+}
+
+// deliver calls the handler subscribed to topic like paho does for an incoming
+// message, reporting whether there was one.
+func (f *fakeMQTT) deliver(topic string, payload string) bool {
+	f.mu.Lock()
+	handler, ok := f.handlers[topic]
+	f.mu.Unlock()
+	if ok {
+		handler(f, fakeMessage{topic: topic, payload: []byte(payload)})
+	}
+	return ok
+}
+
+func (f *fakeMQTT) subscribed(topic string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.handlers[topic]
+	return ok
+}
+
+// last returns the last payload published to topic.
+func (f *fakeMQTT) last(topic string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	messages := f.published[topic]
+	if len(messages) == 0 {
+		return "", false
+	}
+	return messages[len(messages)-1], true
+}
+
+// reset forgets the messages published so far.
+func (f *fakeMQTT) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.published = make(map[string][]string)
+}
+
+// topics returns the topics published to since the last reset, sorted.
+func (f *fakeMQTT) topics() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Sorted(maps.Keys(f.published))
+}
+
+// waitFor fails the test unless want is published to topic within a few seconds.
+func (f *fakeMQTT) waitFor(t *testing.T, topic string, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if got, ok := f.last(topic); ok && got == want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	got, _ := f.last(topic)
+	t.Fatalf("topic %q = %q, want %q", topic, got, want)
+}
+
+// fakeAC is an AC keeping its state in memory and applying the desired states
+// it receives to port1.
+type fakeAC struct {
+	mu    sync.Mutex
+	state *daikin.State
+	sets  []daikin.DesiredState
+	// block makes State wait until its context is done, like an AC that stopped
+	// answering.
+	block bool
+}
+
+var _ AirConditioner = (*fakeAC)(nil)
+
+func newFakeAC(t *testing.T) *fakeAC {
+	t.Helper()
+	return &fakeAC{state: testState(t, `{"port1":{"power":1,"mode":3,"temperature":23,"fan":17,"v_swing":0,"sensors":{"room_temp":26,"out_temp":30}},"idu":1}`)}
+}
+
+func (f *fakeAC) State(ctx context.Context) (*daikin.State, error) {
+	f.mu.Lock()
+	block := f.block
+	f.mu.Unlock()
+	if block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state.Clone(), nil
+}
+
+func (f *fakeAC) SetState(_ context.Context, desired daikin.DesiredState) (*daikin.State, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sets = append(f.sets, desired)
+	p := &f.state.Port1
+	if desired.Port1.Power != nil {
+		p.Power = *desired.Port1.Power
+	}
+	if desired.Port1.Mode != nil {
+		p.Mode = *desired.Port1.Mode
+	}
+	if desired.Port1.Temperature != nil {
+		p.Temperature = *desired.Port1.Temperature
+	}
+	if desired.Port1.Fan != nil {
+		p.Fan = *desired.Port1.Fan
+	}
+	if desired.Port1.VSwing != nil {
+		p.VSwing = *desired.Port1.VSwing
+	}
+	f.state.Ports[daikin.DefaultPortName] = *p
+	return f.state.Clone(), nil
+}
+
+func (f *fakeAC) commands() []daikin.DesiredState {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]daikin.DesiredState(nil), f.sets...)
+}
+
+func testState(t *testing.T, data string) *daikin.State {
+	t.Helper()
+	var state daikin.State
+	if err := json.Unmarshal([]byte(data), &state); err != nil {
+		t.Fatal(err)
+	}
+	return &state
+}
@@ -0,0 +1,62 @@
+package ha
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/locale"
+)
+
+// Options controls the topics and delivery guarantees used to publish entities.
+type Options struct {
+	// BaseTopic prefixes every state, command and availability topic.
+	BaseTopic string
+	// DiscoveryPrefix is the Home Assistant MQTT discovery prefix.
+	DiscoveryPrefix string
+	// StateQoS is used for state, availability and discovery messages.
+	StateQoS byte
+	// CommandQoS is used for the command topic subscriptions.
+	CommandQoS byte
+	// RetainState makes the broker keep the last state of every entity.
+	RetainState bool
+	// HeartbeatInterval is how often the full state is republished even when
+	// nothing changed. Negative values disable the heartbeat.
+	HeartbeatInterval time.Duration
+	// PublishUnknownFields publishes the fields sent by the firmware that are
+	// not decoded yet as a diagnostic sensor.
+	PublishUnknownFields bool
+	// Locale is the language of the entity names and diagnostic messages.
+	Locale locale.Locale
+}
+
+var DefaultOptions = Options{
+	BaseTopic:         "daikin",
+	DiscoveryPrefix:   "homeassistant",
+	HeartbeatInterval: 5 * time.Minute,
+}
+
+func (o Options) withDefaults() Options {
+	if o.BaseTopic == "" {
+		o.BaseTopic = DefaultOptions.BaseTopic
+	}
+	if o.DiscoveryPrefix == "" {
+		o.DiscoveryPrefix = DefaultOptions.DiscoveryPrefix
+	}
+	if o.HeartbeatInterval == 0 {
+		o.HeartbeatInterval = DefaultOptions.HeartbeatInterval
+	}
+	if o.Locale == "" {
+		o.Locale = locale.Default
+	}
+	return o
+}
+
+// topic joins the base topic with the given unique id and suffix.
+func (o Options) topic(uniqueId string, suffix string) string {
+	return fmt.Sprintf("%s/%s/%s", o.BaseTopic, uniqueId, suffix)
+}
+
+// discoveryTopic returns the discovery config topic for the given component.
+func (o Options) discoveryTopic(component string, uniqueId string) string {
+	return fmt.Sprintf("%s/%s/%s/config", o.DiscoveryPrefix, component, uniqueId)
+}
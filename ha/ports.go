@@ -0,0 +1,32 @@
+package ha
+
+import (
+	"maps"
+	"strings"
+)
+
+// portEntity returns the climate entity of port, creating it the first time
+// the port is seen, in which case created is true. The entity of port1 keeps the
+// unique id and topics of the device, the others get the port name appended,
+// e.g. daikin/quarto_port2/mode/state.
+func (c *Climate) portEntity(port string) (entity *ClimateEntity, created bool) {
+	c.portsMu.Lock()
+	defer c.portsMu.Unlock()
+	if e, ok := c.ports[port]; ok {
+		return e, false
+	}
+	uniqueId := c.UniqueId + "_" + port
+	name := c.Name + " " + strings.TrimPrefix(port, "port")
+	e := newClimateEntity(c.options, name, uniqueId, c.Modes, c.FanModes, c.Device)
+	// every port shares the availability of the AC
+	e.AvailabilityTopic = c.AvailabilityTopic
+	c.ports[port] = &e
+	return &e, true
+}
+
+// portEntities returns the entities of the ports seen so far by port name.
+func (c *Climate) portEntities() map[string]*ClimateEntity {
+	c.portsMu.Lock()
+	defer c.portsMu.Unlock()
+	return maps.Clone(c.ports)
+}
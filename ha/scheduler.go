@@ -0,0 +1,128 @@
+package ha
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// PollOptions controls how often a single AC is polled.
+type PollOptions struct {
+	// Interval is used while the AC is on and no command was sent recently.
+	Interval time.Duration
+	// FastInterval is used for FastWindow after a command is sent, so Home
+	// Assistant reflects the change quickly.
+	FastInterval time.Duration
+	FastWindow   time.Duration
+	// IdleInterval is used while the AC is off.
+	IdleInterval time.Duration
+	// UnreachableInterval is used while the AC is not answering.
+	UnreachableInterval time.Duration
+	// UnreachableTimeout bounds the polls of an AC whose last poll found it
+	// unreachable, so dead units do not keep the request slots from the others.
+	UnreachableTimeout time.Duration
+	// StatusInterval is how often the connectivity status (Wi-Fi, cloud) is
+	// queried. It changes rarely, so it is polled much slower than the state.
+	StatusInterval time.Duration
+	// Jitter randomly spreads every interval by up to this fraction, e.g. 0.2
+	// for ±20%, so devices started together do not poll in lockstep. Unlike
+	// the other fields, 0 is kept and disables it.
+	Jitter float64
+}
+
+var DefaultPollOptions = PollOptions{
+	Interval:            5 * time.Second,
+	FastInterval:        1 * time.Second,
+	FastWindow:          15 * time.Second,
+	IdleInterval:        30 * time.Second,
+	UnreachableInterval: 60 * time.Second,
+	UnreachableTimeout:  3 * time.Second,
+	StatusInterval:      5 * time.Minute,
+	Jitter:              0.2,
+}
+
+func (o PollOptions) withDefaults() PollOptions {
+	if o.Interval <= 0 {
+		o.Interval = DefaultPollOptions.Interval
+	}
+	if o.FastInterval <= 0 {
+		o.FastInterval = DefaultPollOptions.FastInterval
+	}
+	if o.FastWindow <= 0 {
+		o.FastWindow = DefaultPollOptions.FastWindow
+	}
+	if o.IdleInterval <= 0 {
+		o.IdleInterval = DefaultPollOptions.IdleInterval
+	}
+	if o.UnreachableInterval <= 0 {
+		o.UnreachableInterval = DefaultPollOptions.UnreachableInterval
+	}
+	if o.UnreachableTimeout <= 0 {
+		o.UnreachableTimeout = DefaultPollOptions.UnreachableTimeout
+	}
+	if o.StatusInterval <= 0 {
+		o.StatusInterval = DefaultPollOptions.StatusInterval
+	}
+	if o.Jitter < 0 || o.Jitter >= 1 {
+		o.Jitter = DefaultPollOptions.Jitter
+	}
+	return o
+}
+
+// next returns the interval until the next poll given the result of the last
+// one and when the last command was sent.
+func (o PollOptions) next(state *daikin.State, err error, lastCommand time.Time) time.Duration {
+	switch {
+	case time.Since(lastCommand) < o.FastWindow:
+		return o.FastInterval
+	case err != nil:
+		return o.UnreachableInterval
+	case state != nil && !state.PoweredOn():
+		return o.IdleInterval
+	default:
+		return o.Interval
+	}
+}
+
+// Scheduler is shared by every climate and caps how many HTTP requests are
+// made to the ACs at the same time.
+type Scheduler struct {
+	slots chan struct{}
+}
+
+const DefaultMaxConcurrent = 4
+
+// NewScheduler creates a *Scheduler allowing at most maxConcurrent requests at
+// once. Values lower than 1 use DefaultMaxConcurrent.
+func NewScheduler(maxConcurrent int) *Scheduler {
+	if maxConcurrent < 1 {
+		maxConcurrent = DefaultMaxConcurrent
+	}
+	return &Scheduler{
+		slots: make(chan struct{}, maxConcurrent),
+	}
+}
+
+// acquire blocks until a request slot is free, returning false if ctx is done first.
+func (s *Scheduler) acquire(ctx context.Context) bool {
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Scheduler) release() {
+	<-s.slots
+}
+
+// jitter spreads d randomly by up to the given fraction in both directions.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
@@ -0,0 +1,181 @@
+package ha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+func TestPollOptionsWithDefaults(t *testing.T) {
+	got := PollOptions{Interval: 2 * time.Second, Jitter: 0}.withDefaults()
+	want := DefaultPollOptions
+	want.Interval = 2 * time.Second
+	want.Jitter = 0
+	if got != want {
+		t.Errorf("withDefaults() = %+v, want %+v", got, want)
+	}
+
+	for _, jitter := range []float64{-0.1, 1, 1.5} {
+		if got := (PollOptions{Jitter: jitter}).withDefaults().Jitter; got != DefaultPollOptions.Jitter {
+			t.Errorf("jitter %v = %v, want the default %v", jitter, got, DefaultPollOptions.Jitter)
+		}
+	}
+}
+
+func TestPollOptionsNext(t *testing.T) {
+	opts := DefaultPollOptions
+	on := testState(t, `{"port1":{"power":1}}`)
+	off := testState(t, `{"port1":{"power":0}}`)
+	secondPortOn := testState(t, `{"port1":{"power":0},"port2":{"power":1}}`)
+	unreachable := fmt.Errorf("%w: timeout", daikin.ErrUnreachable)
+
+	tests := []struct {
+		name        string
+		state       *daikin.State
+		err         error
+		lastCommand time.Time
+		want        time.Duration
+	}{
+		{name: "on", state: on, want: opts.Interval},
+		{name: "off", state: off, want: opts.IdleInterval},
+		{name: "any port on", state: secondPortOn, want: opts.Interval},
+		{name: "unreachable", err: unreachable, want: opts.UnreachableInterval},
+		{name: "command sent recently", state: off, lastCommand: time.Now().Add(-time.Second), want: opts.FastInterval},
+		{name: "command sent recently to an unreachable ac", err: unreachable, lastCommand: time.Now(), want: opts.FastInterval},
+		{name: "fast window over", state: on, lastCommand: time.Now().Add(-opts.FastWindow - time.Second), want: opts.Interval},
+		{name: "no state yet", want: opts.Interval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := opts.next(tt.state, tt.err, tt.lastCommand); got != tt.want {
+				t.Errorf("next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJitterBounds(t *testing.T) {
+	const d = 10 * time.Second
+	if got := jitter(d, 0); got != d {
+		t.Errorf("jitter(%v, 0) = %v, want it unchanged", d, got)
+	}
+	var below, above bool
+	for range 1000 {
+		got := jitter(d, 0.2)
+		if got < 8*time.Second || got > 12*time.Second {
+			t.Fatalf("jitter(%v, 0.2) = %v, want within ±20%%", d, got)
+		}
+		below = below || got < d
+		above = above || got > d
+	}
+	if !below || !above {
+		t.Errorf("jitter only spread one way: below %v, above %v", below, above)
+	}
+}
+
+func TestSchedulerCapsConcurrency(t *testing.T) {
+	const slots = 2
+	s := NewScheduler(slots)
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !s.acquire(context.Background()) {
+				t.Error("acquire() = false without a deadline")
+				return
+			}
+			n := running.Add(1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			s.release()
+		}()
+	}
+	wg.Wait()
+	if got := peak.Load(); got != slots {
+		t.Errorf("peak concurrency = %d, want %d", got, slots)
+	}
+}
+
+func TestSchedulerAcquireStopsWithContext(t *testing.T) {
+	s := NewScheduler(1)
+	if !s.acquire(context.Background()) {
+		t.Fatal("acquire() = false on a free scheduler")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if s.acquire(ctx) {
+		t.Fatal("acquire() = true while every slot is taken")
+	}
+	s.release()
+	if !s.acquire(context.Background()) {
+		t.Fatal("acquire() = false after release")
+	}
+}
+
+func TestNewSchedulerDefault(t *testing.T) {
+	if got := cap(NewScheduler(0).slots); got != DefaultMaxConcurrent {
+		t.Errorf("slots = %d, want %d", got, DefaultMaxConcurrent)
+	}
+}
+
+// deadAC never answers, recording whether each poll had a deadline.
+type deadAC struct {
+	mu        sync.Mutex
+	deadlines []bool
+}
+
+func (a *deadAC) State(ctx context.Context) (*daikin.State, error) {
+	_, ok := ctx.Deadline()
+	a.mu.Lock()
+	a.deadlines = append(a.deadlines, ok)
+	a.mu.Unlock()
+	return nil, fmt.Errorf("%w: no route to host", daikin.ErrUnreachable)
+}
+
+func (a *deadAC) SetState(context.Context, daikin.DesiredState) (*daikin.State, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *deadAC) polls() []bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]bool(nil), a.deadlines...)
+}
+
+func TestClimateShortensThePollsOfUnreachableACs(t *testing.T) {
+	ac := &deadAC{}
+	c := newTestClimate(t, ac, newFakeMQTT())
+	c.Start(context.Background())
+	defer c.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ac.polls()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	polls := ac.polls()
+	if len(polls) < 3 {
+		t.Fatalf("polled %d times, want at least 3", len(polls))
+	}
+	if polls[0] {
+		t.Error("first poll had the unreachable timeout before the AC was known to be unreachable")
+	}
+	for i, ok := range polls[1:] {
+		if !ok {
+			t.Errorf("poll %d of an unreachable AC had no deadline", i+1)
+		}
+	}
+}
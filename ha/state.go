@@ -0,0 +1,70 @@
+package ha
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// stateStore holds the last state read from an AC. It is written by the poll
+// goroutine and read by the command handlers running on paho goroutines, so
+// every access is guarded and only copies ever leave the store.
+type stateStore struct {
+	mu          sync.RWMutex
+	state       *daikin.State
+	subscribers map[chan *daikin.State]struct{}
+}
+
+func newStateStore() *stateStore {
+	return &stateStore{
+		subscribers: make(map[chan *daikin.State]struct{}),
+	}
+}
+
+// Snapshot returns a copy of the current state, or nil if none was stored yet.
+func (s *stateStore) Snapshot() *daikin.State {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state.Clone()
+}
+
+// Update stores a copy of state and notifies the subscribers when it differs
+// from the current one. It reports whether the state changed.
+func (s *stateStore) Update(state *daikin.State) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reflect.DeepEqual(state, s.state) {
+		return false
+	}
+	s.state = state.Clone()
+	for ch := range s.subscribers {
+		// subscribers only care about the latest state, so a pending one that
+		// was not consumed yet is replaced instead of blocking the poller.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- s.state.Clone()
+	}
+	return true
+}
+
+// Subscribe returns a channel receiving a snapshot of every state change and a
+// function that unsubscribes and closes the channel.
+func (s *stateStore) Subscribe() (<-chan *daikin.State, func()) {
+	ch := make(chan *daikin.State, 1)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package ha
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateStoreUpdate(t *testing.T) {
+	store := newStateStore()
+	if store.Snapshot() != nil {
+		t.Fatal("Snapshot() of an empty store is not nil")
+	}
+
+	state := testState(t, `{"port1":{"power":1,"mode":3,"temperature":23},"idu":1}`)
+	if !store.Update(state) {
+		t.Fatal("Update() of the first state = false, want true")
+	}
+	if store.Update(state.Clone()) {
+		t.Fatal("Update() of an equal state = true, want false")
+	}
+
+	changed := state.Clone()
+	changed.Port1.Temperature = 24
+	if !store.Update(changed) {
+		t.Fatal("Update() of a changed state = false, want true")
+	}
+
+	// neither the stored state nor the snapshots share memory with the caller
+	changed.Port1.Temperature = 30
+	snapshot := store.Snapshot()
+	if snapshot.Port1.Temperature != 24 {
+		t.Fatalf("stored temperature = %v, want 24", snapshot.Port1.Temperature)
+	}
+	snapshot.Port1.Temperature = 18
+	if got := store.Snapshot().Port1.Temperature; got != 24 {
+		t.Fatalf("stored temperature after changing a snapshot = %v, want 24", got)
+	}
+}
+
+func TestStateStoreSubscribe(t *testing.T) {
+	store := newStateStore()
+	updates, unsubscribe := store.Subscribe()
+
+	first := testState(t, `{"port1":{"temperature":21},"idu":1}`)
+	second := testState(t, `{"port1":{"temperature":22},"idu":1}`)
+	store.Update(first)
+	store.Update(second)
+
+	// only the latest state is kept for a subscriber that did not read yet
+	select {
+	case got := <-updates:
+		if got.Port1.Temperature != 22 {
+			t.Fatalf("received temperature = %v, want 22", got.Port1.Temperature)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no update received")
+	}
+	select {
+	case got := <-updates:
+		t.Fatalf("received a stale update %v", got.Port1.Temperature)
+	default:
+	}
+
+	unsubscribe()
+	unsubscribe()
+	if _, ok := <-updates; ok {
+		t.Fatal("channel still open after unsubscribe")
+	}
+	// updates after unsubscribing must not panic on the closed channel
+	store.Update(first)
+}
+
+func TestStateStoreConcurrentAccess(t *testing.T) {
+	store := newStateStore()
+	base := testState(t, `{"port1":{"power":1,"temperature":20},"idu":1}`)
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				state := base.Clone()
+				state.Port1.Temperature = float64(20 + (i+j)%10)
+				store.Update(state)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				if s := store.Snapshot(); s != nil {
+					s.Port1.Temperature = -1
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				updates, unsubscribe := store.Subscribe()
+				select {
+				case <-updates:
+				default:
+				}
+				unsubscribe()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := store.Snapshot().Port1.Temperature; got < 20 || got >= 30 {
+		t.Fatalf("temperature = %v, a snapshot change leaked into the store", got)
+	}
+}
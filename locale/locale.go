@@ -0,0 +1,84 @@
+// Package locale translates the names shown to users: the Home Assistant
+// entity names, the diagnostic messages and the CLI output. Identifiers such as
+// topics, unique ids and JSON values are never translated, and the log
+// messages stay in English, only the diagnostic message they carry follows the
+// locale.
+package locale
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/billbatista/ha-daikin-smart-ac-br/daikin"
+)
+
+// Locale is a language tag, e.g. pt-BR.
+type Locale string
+
+const (
+	PtBR Locale = "pt-BR"
+	En   Locale = "en"
+	Es   Locale = "es"
+	// Default is used when no locale is configured.
+	Default = PtBR
+	// Env selects the locale of the commands run without a config file.
+	Env = "DAIKIN_LOCALE"
+)
+
+// Locales lists the supported locales.
+var Locales = []Locale{PtBR, En, Es}
+
+// Parse returns the supported locale matching tag, ignoring case and accepting
+// _ as separator and the language alone, e.g. "pt_br", "pt" or "en-US". An
+// empty tag is Default.
+func Parse(tag string) (Locale, error) {
+	if tag == "" {
+		return Default, nil
+	}
+	tag = strings.ToLower(strings.ReplaceAll(tag, "_", "-"))
+	language, _, _ := strings.Cut(tag, "-")
+	for _, l := range Locales {
+		if strings.ToLower(string(l)) == tag {
+			return l, nil
+		}
+	}
+	for _, l := range Locales {
+		if code, _, _ := strings.Cut(strings.ToLower(string(l)), "-"); code == language {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported locale %q, must be one of pt-BR, en or es", tag)
+}
+
+// Text returns the translation of key, falling back to English and then to the
+// key itself.
+func (l Locale) Text(key string) string {
+	if text, ok := l.lookup(key); ok {
+		return text
+	}
+	return key
+}
+
+func (l Locale) lookup(key string) (string, bool) {
+	if text, ok := messages[l][key]; ok {
+		return text, true
+	}
+	text, ok := messages[En][key]
+	return text, ok
+}
+
+// Mode returns the name of the mode, or its identifier when unknown.
+func (l Locale) Mode(m daikin.Mode) string {
+	if text, ok := l.lookup("mode." + m.String()); ok {
+		return text
+	}
+	return m.String()
+}
+
+// Fan returns the name of the fan speed, or its identifier when unknown.
+func (l Locale) Fan(f daikin.Fan) string {
+	if text, ok := l.lookup("fan." + f.String()); ok {
+		return text
+	}
+	return f.String()
+}
@@ -0,0 +1,155 @@
+package locale
+
+// messages holds the translations by locale and key. English must have every
+// key, the other locales fall back to it.
+var messages = map[Locale]map[string]string{
+	PtBR: {
+		"entity.climate":        "Ar Condicionado",
+		"entity.diagnostic":     "Diagnóstico",
+		"entity.unknown_fields": "Campos desconhecidos",
+		"entity.cloud":          "Nuvem",
+		"entity.wifi":           "Wi-Fi",
+		"entity.ac_link":        "Comunicação com o aparelho",
+		"entity.ssid":           "Rede Wi-Fi",
+		"entity.mqtt":           "Conexão MQTT",
+
+		"diagnosis.ok":               "Aparelho respondendo normalmente",
+		"diagnosis.unreachable":      "O aparelho não responde no endereço configurado. Verifique se está ligado e conectado ao Wi-Fi",
+		"diagnosis.wrong_endpoint":   "O endereço responde, mas não como um ar condicionado Daikin. Verifique o IP e a porta",
+		"diagnosis.wrong_key":        "O aparelho respondeu, mas a secret key configurada não decodifica a resposta. Verifique a secret_key",
+		"diagnosis.invalid_response": "A resposta do aparelho veio corrompida (CRC inválido)",
+		"diagnosis.unknown":          "Erro desconhecido, verifique o log",
+
+		"mode.auto":     "Automático",
+		"mode.dry":      "Desumidificar",
+		"mode.cool":     "Resfriar",
+		"mode.heat":     "Aquecer",
+		"mode.fan_only": "Ventilar",
+
+		"fan.low":         "Baixa",
+		"fan.medium_low":  "Média-Baixa",
+		"fan.medium":      "Média",
+		"fan.medium_high": "Média-Alta",
+		"fan.high":        "Alta",
+		"fan.auto":        "Automático",
+		"fan.quiet":       "Silencioso",
+
+		"cli.power":               "ligado",
+		"cli.mode":                "modo",
+		"cli.target_temperature":  "temperatura desejada",
+		"cli.fan":                 "ventilação",
+		"cli.room_temperature":    "temperatura ambiente",
+		"cli.outdoor_temperature": "temperatura externa",
+		"cli.horizontal_swing":    "swing horizontal",
+		"cli.vertical_swing":      "swing vertical",
+		"cli.econo":               "econo",
+		"cli.powerchill":          "powerchill",
+		"cli.streamer":            "streamer",
+		"cli.firmware":            "firmware",
+		"cli.unknown":             "desconhecido",
+		"cli.username":            "usuário",
+		"cli.station_ssid":        "rede wi-fi",
+		"cli.ac":                  "aparelho",
+		"cli.station":             "wi-fi",
+		"cli.cloud":               "nuvem",
+		"cli.auth":                "autenticação",
+	},
+	En: {
+		"entity.climate":        "Air Conditioner",
+		"entity.diagnostic":     "Diagnostic",
+		"entity.unknown_fields": "Unknown fields",
+		"entity.cloud":          "Cloud",
+		"entity.wifi":           "Wi-Fi",
+		"entity.ac_link":        "AC link",
+		"entity.ssid":           "Wi-Fi network",
+		"entity.mqtt":           "MQTT connection",
+
+		"diagnosis.ok":               "The AC is answering normally",
+		"diagnosis.unreachable":      "The AC does not answer at the configured address. Check that it is powered and connected to the Wi-Fi",
+		"diagnosis.wrong_endpoint":   "The address answers, but not like a Daikin AC. Check the IP and port",
+		"diagnosis.wrong_key":        "The AC answered, but the configured secret key does not decrypt the response. Check the secret_key",
+		"diagnosis.invalid_response": "The response of the AC was corrupted (invalid CRC)",
+		"diagnosis.unknown":          "Unknown error, check the log",
+
+		"mode.auto":     "Auto",
+		"mode.dry":      "Dry",
+		"mode.cool":     "Cool",
+		"mode.heat":     "Heat",
+		"mode.fan_only": "Fan only",
+
+		"fan.low":         "Low",
+		"fan.medium_low":  "Medium-low",
+		"fan.medium":      "Medium",
+		"fan.medium_high": "Medium-high",
+		"fan.high":        "High",
+		"fan.auto":        "Auto",
+		"fan.quiet":       "Quiet",
+
+		"cli.power":               "power",
+		"cli.mode":                "mode",
+		"cli.target_temperature":  "target temperature",
+		"cli.fan":                 "fan",
+		"cli.room_temperature":    "room temperature",
+		"cli.outdoor_temperature": "outdoor temperature",
+		"cli.horizontal_swing":    "horizontal swing",
+		"cli.vertical_swing":      "vertical swing",
+		"cli.econo":               "econo",
+		"cli.powerchill":          "powerchill",
+		"cli.streamer":            "streamer",
+		"cli.firmware":            "firmware",
+		"cli.unknown":             "unknown",
+		"cli.username":            "username",
+		"cli.station_ssid":        "station ssid",
+		"cli.ac":                  "ac",
+		"cli.station":             "station",
+		"cli.cloud":               "cloud",
+		"cli.auth":                "auth",
+	},
+	Es: {
+		"entity.climate":        "Aire Acondicionado",
+		"entity.diagnostic":     "Diagnóstico",
+		"entity.unknown_fields": "Campos desconocidos",
+		"entity.cloud":          "Nube",
+		"entity.wifi":           "Wi-Fi",
+		"entity.ac_link":        "Comunicación con el equipo",
+		"entity.ssid":           "Red Wi-Fi",
+		"entity.mqtt":           "Conexión MQTT",
+
+		"diagnosis.ok":               "El equipo responde normalmente",
+		"diagnosis.unreachable":      "El equipo no responde en la dirección configurada. Verifique que esté encendido y conectado al Wi-Fi",
+		"diagnosis.wrong_endpoint":   "La dirección responde, pero no como un aire acondicionado Daikin. Verifique la IP y el puerto",
+		"diagnosis.wrong_key":        "El equipo respondió, pero la secret key configurada no descifra la respuesta. Verifique la secret_key",
+		"diagnosis.invalid_response": "La respuesta del equipo llegó dañada (CRC inválido)",
+		"diagnosis.unknown":          "Error desconocido, revise el log",
+
+		"mode.auto":     "Automático",
+		"mode.dry":      "Deshumidificar",
+		"mode.cool":     "Enfriar",
+		"mode.heat":     "Calentar",
+		"mode.fan_only": "Ventilar",
+
+		"fan.low":         "Baja",
+		"fan.medium_low":  "Media-baja",
+		"fan.medium":      "Media",
+		"fan.medium_high": "Media-alta",
+		"fan.high":        "Alta",
+		"fan.auto":        "Automático",
+		"fan.quiet":       "Silencioso",
+
+		"cli.power":               "encendido",
+		"cli.mode":                "modo",
+		"cli.target_temperature":  "temperatura deseada",
+		"cli.fan":                 "ventilación",
+		"cli.room_temperature":    "temperatura ambiente",
+		"cli.outdoor_temperature": "temperatura exterior",
+		"cli.horizontal_swing":    "swing horizontal",
+		"cli.vertical_swing":      "swing vertical",
+		"cli.unknown":             "desconocido",
+		"cli.username":            "usuario",
+		"cli.station_ssid":        "red wi-fi",
+		"cli.ac":                  "equipo",
+		"cli.station":             "wi-fi",
+		"cli.cloud":               "nube",
+		"cli.auth":                "autenticación",
+	},
+}
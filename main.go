@@ -11,7 +11,7 @@ import (
 func main() {
 	ctx := context.Background()
 
-	if err := cmd.Server(ctx); err != nil {
+	if err := cmd.Run(ctx, os.Args[1:]); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
 		os.Exit(1)
 	}
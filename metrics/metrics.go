@@ -0,0 +1,244 @@
+// Package metrics is a minimal Prometheus registry writing the text exposition
+// format, so the bridge can be scraped without extra dependencies.
+//
+// Labels are given as alternating names and values, e.g.
+// polls.Inc("device", "quarto", "result", "ok").
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit the latency in seconds of requests made to the ACs.
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 15}
+
+type kind string
+
+const (
+	counter   kind = "counter"
+	gauge     kind = "gauge"
+	histogram kind = "histogram"
+)
+
+// Registry holds the metric families and serves them.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	buckets []float64
+	fn      func() float64
+	series  map[string]*series
+}
+
+type series struct {
+	labels []string
+	value  float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(name string, help string, k kind, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := &family{name: name, help: help, kind: k, buckets: buckets, series: make(map[string]*series)}
+	r.families = append(r.families, f)
+	return f
+}
+
+// series returns the series of f with the given labels, creating it.
+func (r *Registry) series(f *family, labels []string) *series {
+	if len(labels)%2 != 0 {
+		panic(fmt.Sprintf("metrics: odd number of label names and values for %s", f.name))
+	}
+	key := strings.Join(labels, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: slices.Clone(labels)}
+		if f.kind == histogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter only goes up.
+type Counter struct {
+	r *Registry
+	f *family
+}
+
+func (r *Registry) Counter(name string, help string) *Counter {
+	return &Counter{r: r, f: r.register(name, help, counter, nil)}
+}
+
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *Counter) Add(v float64, labels ...string) {
+	c.r.mu.Lock()
+	defer c.r.mu.Unlock()
+	c.r.series(c.f, labels).value += v
+}
+
+// Gauge is set to the current value of something.
+type Gauge struct {
+	r *Registry
+	f *family
+}
+
+func (r *Registry) Gauge(name string, help string) *Gauge {
+	return &Gauge{r: r, f: r.register(name, help, gauge, nil)}
+}
+
+func (g *Gauge) Set(v float64, labels ...string) {
+	g.r.mu.Lock()
+	defer g.r.mu.Unlock()
+	g.r.series(g.f, labels).value = v
+}
+
+// GaugeFunc registers a gauge without labels whose value is read from fn on
+// every scrape.
+func (r *Registry) GaugeFunc(name string, help string, fn func() float64) {
+	f := r.register(name, help, gauge, nil)
+	f.fn = fn
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	r *Registry
+	f *family
+}
+
+// Histogram registers a histogram with the given upper bounds, in increasing
+// order. DefaultBuckets is used when none is given.
+func (r *Registry) Histogram(name string, help string, buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{r: r, f: r.register(name, help, histogram, buckets)}
+}
+
+func (h *Histogram) Observe(v float64, labels ...string) {
+	h.r.mu.Lock()
+	defer h.r.mu.Unlock()
+	s := h.r.series(h.f, labels)
+	for i, bound := range h.f.buckets {
+		if v <= bound {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// Delete removes from every family the series with the label name set to
+// value, e.g. the series of a device removed from the config.
+func (r *Registry) Delete(name string, value string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		for key, s := range f.series {
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				if s.labels[i] == name && s.labels[i+1] == value {
+					delete(f.series, key)
+					break
+				}
+			}
+		}
+	}
+}
+
+// WriteTo writes every family in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range r.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		if f.fn != nil {
+			fmt.Fprintf(&b, "%s %s\n", f.name, formatFloat(f.fn()))
+			continue
+		}
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			if f.kind != histogram {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, formatLabels(s.labels), formatFloat(s.value))
+				continue
+			}
+			for i, bound := range f.buckets {
+				labels := append(slices.Clone(s.labels), "le", formatFloat(bound))
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, formatLabels(labels), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, formatLabels(append(slices.Clone(s.labels), "le", "+Inf")), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, formatLabels(s.labels), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, formatLabels(s.labels), s.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to Prometheus.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escape(labels[i+1], true)))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// escape escapes a help text, or a label value when quoted is set.
+func escape(s string, quoted bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quoted {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(r *Registry)
+		want  string
+	}{
+		{
+			name: "counter",
+			setup: func(r *Registry) {
+				c := r.Counter("daikin_polls_total", "Polls made to the ACs.")
+				c.Inc("device", "sala", "result", "ok")
+				c.Inc("device", "quarto", "result", "ok")
+				c.Add(2, "device", "quarto", "result", "ok")
+				c.Inc("device", "quarto", "result", "timeout")
+			},
+			want: `# HELP daikin_polls_total Polls made to the ACs.
+# TYPE daikin_polls_total counter
+daikin_polls_total{device="quarto",result="ok"} 3
+daikin_polls_total{device="quarto",result="timeout"} 1
+daikin_polls_total{device="sala",result="ok"} 1
+`,
+		},
+		{
+			name: "counter without labels",
+			setup: func(r *Registry) {
+				r.Counter("daikin_reconnects_total", "Reconnections.").Add(0.5)
+			},
+			want: `# HELP daikin_reconnects_total Reconnections.
+# TYPE daikin_reconnects_total counter
+daikin_reconnects_total 0.5
+`,
+		},
+		{
+			name: "gauge keeps the last value",
+			setup: func(r *Registry) {
+				g := r.Gauge("daikin_room_temperature_celsius", "Room temperature.")
+				g.Set(26, "device", "quarto")
+				g.Set(24.5, "device", "quarto")
+				g.Set(-1, "device", "sala")
+			},
+			want: `# HELP daikin_room_temperature_celsius Room temperature.
+# TYPE daikin_room_temperature_celsius gauge
+daikin_room_temperature_celsius{device="quarto"} 24.5
+daikin_room_temperature_celsius{device="sala"} -1
+`,
+		},
+		{
+			name: "gauge func is read on every scrape",
+			setup: func(r *Registry) {
+				r.GaugeFunc("daikin_mqtt_connected", "Whether the bridge is connected.", func() float64 { return 1 })
+				r.GaugeFunc("daikin_not_a_number", "NaN.", math.NaN)
+				r.GaugeFunc("daikin_infinite", "Inf.", func() float64 { return math.Inf(-1) })
+			},
+			want: `# HELP daikin_mqtt_connected Whether the bridge is connected.
+# TYPE daikin_mqtt_connected gauge
+daikin_mqtt_connected 1
+# HELP daikin_not_a_number NaN.
+# TYPE daikin_not_a_number gauge
+daikin_not_a_number NaN
+# HELP daikin_infinite Inf.
+# TYPE daikin_infinite gauge
+daikin_infinite -Inf
+`,
+		},
+		{
+			name: "histogram buckets are cumulative",
+			setup: func(r *Registry) {
+				h := r.Histogram("daikin_request_duration_seconds", "Request latency.", []float64{0.1, 1, 2.5})
+				h.Observe(0.05, "device", "quarto")
+				h.Observe(0.1, "device", "quarto")
+				h.Observe(2, "device", "quarto")
+				h.Observe(30, "device", "quarto")
+			},
+			want: `# HELP daikin_request_duration_seconds Request latency.
+# TYPE daikin_request_duration_seconds histogram
+daikin_request_duration_seconds_bucket{device="quarto",le="0.1"} 2
+daikin_request_duration_seconds_bucket{device="quarto",le="1"} 2
+daikin_request_duration_seconds_bucket{device="quarto",le="2.5"} 3
+daikin_request_duration_seconds_bucket{device="quarto",le="+Inf"} 4
+daikin_request_duration_seconds_sum{device="quarto"} 32.15
+daikin_request_duration_seconds_count{device="quarto"} 4
+`,
+		},
+		{
+			name: "histogram uses the default buckets",
+			setup: func(r *Registry) {
+				r.Histogram("daikin_latency_seconds", "Latency.", nil).Observe(0.3)
+			},
+			want: `# HELP daikin_latency_seconds Latency.
+# TYPE daikin_latency_seconds histogram
+daikin_latency_seconds_bucket{le="0.01"} 0
+daikin_latency_seconds_bucket{le="0.025"} 0
+daikin_latency_seconds_bucket{le="0.05"} 0
+daikin_latency_seconds_bucket{le="0.1"} 0
+daikin_latency_seconds_bucket{le="0.25"} 0
+daikin_latency_seconds_bucket{le="0.5"} 1
+daikin_latency_seconds_bucket{le="1"} 1
+daikin_latency_seconds_bucket{le="2.5"} 1
+daikin_latency_seconds_bucket{le="5"} 1
+daikin_latency_seconds_bucket{le="10"} 1
+daikin_latency_seconds_bucket{le="15"} 1
+daikin_latency_seconds_bucket{le="+Inf"} 1
+daikin_latency_seconds_sum 0.3
+daikin_latency_seconds_count 1
+`,
+		},
+		{
+			name: "label values and help are escaped",
+			setup: func(r *Registry) {
+				r.Gauge("daikin_info", "Info about \"the\" AC.\nSee C:\\docs.").
+					Set(1, "device", "sala \"grande\"", "path", `C:\ac`, "note", "two\nlines")
+			},
+			want: `# HELP daikin_info Info about "the" AC.\nSee C:\\docs.
+# TYPE daikin_info gauge
+daikin_info{device="sala \"grande\"",path="C:\\ac",note="two\nlines"} 1
+`,
+		},
+		{
+			name: "families without series only write the header",
+			setup: func(r *Registry) {
+				r.Counter("daikin_commands_total", "Commands.")
+			},
+			want: `# HELP daikin_commands_total Commands.
+# TYPE daikin_commands_total counter
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			tt.setup(r)
+			assertOutput(t, r, tt.want)
+		})
+	}
+}
+
+func TestRegistryDelete(t *testing.T) {
+	r := NewRegistry()
+	polls := r.Counter("daikin_polls_total", "Polls.")
+	temp := r.Gauge("daikin_room_temperature_celsius", "Room temperature.")
+	latency := r.Histogram("daikin_request_duration_seconds", "Latency.", []float64{1})
+	r.GaugeFunc("daikin_mqtt_connected", "Connected.", func() float64 { return 0 })
+	for _, device := range []string{"quarto", "sala"} {
+		polls.Inc("device", device, "result", "ok")
+		temp.Set(25, "device", device)
+		latency.Observe(0.5, "device", device)
+	}
+	// a value matching another label is kept
+	polls.Inc("device", "sala", "result", "quarto")
+
+	r.Delete("device", "quarto")
+
+	assertOutput(t, r, `# HELP daikin_polls_total Polls.
+# TYPE daikin_polls_total counter
+daikin_polls_total{device="sala",result="ok"} 1
+daikin_polls_total{device="sala",result="quarto"} 1
+# HELP daikin_room_temperature_celsius Room temperature.
+# TYPE daikin_room_temperature_celsius gauge
+daikin_room_temperature_celsius{device="sala"} 25
+# HELP daikin_request_duration_seconds Latency.
+# TYPE daikin_request_duration_seconds histogram
+daikin_request_duration_seconds_bucket{device="sala",le="1"} 1
+daikin_request_duration_seconds_bucket{device="sala",le="+Inf"} 1
+daikin_request_duration_seconds_sum{device="sala"} 0.5
+daikin_request_duration_seconds_count{device="sala"} 1
+# HELP daikin_mqtt_connected Connected.
+# TYPE daikin_mqtt_connected gauge
+daikin_mqtt_connected 0
+`)
+
+	// a deleted series starts over when used again
+	polls.Inc("device", "quarto", "result", "ok")
+	if out := output(t, r); !strings.Contains(out, `daikin_polls_total{device="quarto",result="ok"} 1`+"\n") {
+		t.Errorf("series not recreated after delete:\n%s", out)
+	}
+}
+
+func TestRegistryPanicsOnOddLabels(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a label name without value")
+		}
+	}()
+	NewRegistry().Counter("daikin_polls_total", "Polls.").Inc("device")
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("daikin_polls_total", "Polls.").Inc("device", "quarto")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if got, want := rec.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8"; got != want {
+		t.Errorf("Content-Type = %q, want %q", got, want)
+	}
+	want := `# HELP daikin_polls_total Polls.
+# TYPE daikin_polls_total counter
+daikin_polls_total{device="quarto"} 1
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("body:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func output(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if int(n) != b.Len() {
+		t.Errorf("WriteTo returned %d bytes, wrote %d", n, b.Len())
+	}
+	return b.String()
+}
+
+func assertOutput(t *testing.T, r *Registry, want string) {
+	t.Helper()
+	if got := output(t, r); got != want {
+		t.Errorf("output:\n%s\nwant:\n%s", got, want)
+	}
+}